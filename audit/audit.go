@@ -0,0 +1,137 @@
+// Package audit keeps a durable record of retry sessions for postmortems.
+//
+// Each session run through Backoff is written to a Sink as JSON lines while it
+// runs: one when it starts, naming the operation and its policy, one for every
+// attempt as soon as it returns, and one with the outcome. Sessions which
+// never end, because they retry indefinitely or the process crashed, are
+// still on record up to their last attempt. The log can later be read back
+// with a Reader and each session replayed against a FakeClock to reproduce
+// its timeline.
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// Outcome is how a retry session ended.
+type Outcome string
+
+const (
+	// OutcomeSuccess means Func eventually returned a value.
+	OutcomeSuccess Outcome = "success"
+	// OutcomeFailure means the session gave up without a value.
+	OutcomeFailure Outcome = "failure"
+	// OutcomeIncomplete means the log ends before the session did, eg.
+	// because it is still running or the process crashed.
+	OutcomeIncomplete Outcome = "incomplete"
+)
+
+// Attempt is a single call of Func within a session.
+type Attempt struct {
+	// Number is the attempt number, starting at 1.
+	Number int `json:"number"`
+	// Delay is how long the engine waited before making the attempt.
+	Delay time.Duration `json:"delay"`
+	// Start is when the attempt was made.
+	Start time.Time `json:"start"`
+	// Duration is how long Func took to return.
+	Duration time.Duration `json:"duration"`
+	// Error is the error returned by Func, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Session is the record of one call to Backoff.
+type Session struct {
+	// ID identifies the session's lines in the log.
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	Policy    string    `json:"policy"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Attempts  []Attempt `json:"attempts"`
+	Outcome   Outcome   `json:"outcome"`
+	// Errors are the errors returned by Backoff, which can include errors
+	// that did not come from an attempt, such as ErrInvalidConfig.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Backoff runs conf through backoff.Backoff, writing the session to sink as it
+// goes.
+//
+// `operation` names what is being retried, and `policy` is a human readable
+// description of the retry policy, as neither can be derived from the config.
+func Backoff[T any](sink *Sink, operation, policy string, conf backoff.Config[T]) (*T, []error) {
+	session := Session{
+		ID:        newID(),
+		Operation: operation,
+		Policy:    policy,
+		Start:     time.Now(),
+	}
+	write := func(r record) {
+		if err := sink.write(r); err != nil && sink.LogError != nil {
+			sink.LogError(err)
+		}
+	}
+	write(startRecord(session))
+
+	var delay time.Duration
+	if curve := conf.Curve; curve != nil {
+		// The curve is called once per attempt, so that the recorded delay
+		// matches the one used even for curves with jitter.
+		conf.Curve = func(x float64) float64 {
+			v := curve(x)
+			constant := func(float64) float64 { return v }
+			if conf.FractionalDelays {
+				delay = backoff.FractionalDelay(constant, 0)
+			} else {
+				delay = backoff.Delay(constant, 0)
+			}
+			return v
+		}
+	}
+	if fn := conf.Func; fn != nil {
+		conf.Func = func() (*T, error) {
+			attempt := Attempt{
+				Number: len(session.Attempts) + 1,
+				Delay:  delay,
+				Start:  time.Now(),
+			}
+			res, err := fn()
+			attempt.Duration = time.Since(attempt.Start)
+			if err != nil {
+				attempt.Error = err.Error()
+			}
+			session.Attempts = append(session.Attempts, attempt)
+			write(attemptRecord(session, attempt))
+			return res, err
+		}
+	}
+
+	res, errs := backoff.Backoff(conf)
+
+	session.End = time.Now()
+	session.Outcome = OutcomeFailure
+	if res != nil {
+		session.Outcome = OutcomeSuccess
+	}
+	for _, err := range errs {
+		session.Errors = append(session.Errors, err.Error())
+	}
+
+	write(endRecord(session))
+
+	return res, errs
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// readAll reads every session from the files at paths, in order.
+func readAll(t *testing.T, paths ...string) []Session {
+	t.Helper()
+	var readers []io.Reader
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		readers = append(readers, f)
+	}
+
+	r := NewReader(io.MultiReader(readers...))
+	var sessions []Session
+	for {
+		session, err := r.Next()
+		if err == io.EOF {
+			return sessions
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewSink(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	calls := 0
+	value := 1
+	res, errs := Backoff(sink, "fetch", "constant 10ms", backoff.Config[int]{
+		Curve: func(float64) float64 { return 0.01 },
+		Func: func() (*int, error) {
+			calls++
+			if calls < 3 {
+				return nil, errors.New("not yet")
+			}
+			return &value, nil
+		},
+		MaxAttempts:      5,
+		FractionalDelays: true,
+	})
+	if res == nil {
+		t.Fatalf("Backoff failed: %v", errs)
+	}
+
+	sessions := readAll(t, path)
+	if len(sessions) != 1 {
+		t.Fatalf("read %d sessions, want 1", len(sessions))
+	}
+	s := sessions[0]
+	if s.Operation != "fetch" || s.Policy != "constant 10ms" || s.Outcome != OutcomeSuccess {
+		t.Errorf("session = %q, %q, %q", s.Operation, s.Policy, s.Outcome)
+	}
+	if len(s.Attempts) != 3 {
+		t.Fatalf("read %d attempts, want 3", len(s.Attempts))
+	}
+	for i, a := range s.Attempts {
+		if a.Number != i+1 {
+			t.Errorf("attempt %d numbered %d", i+1, a.Number)
+		}
+	}
+	if s.Attempts[0].Error != "not yet" || s.Attempts[2].Error != "" {
+		t.Errorf("attempt errors = %q, %q", s.Attempts[0].Error, s.Attempts[2].Error)
+	}
+	if s.Attempts[1].Delay != 10*time.Millisecond {
+		t.Errorf("second attempt delay = %s, want 10ms", s.Attempts[1].Delay)
+	}
+
+	// Replaying reproduces when each attempt was made.
+	clock := NewFakeClock(s.Start)
+	var at []time.Time
+	Replay(s, clock, func(t time.Time, _ Attempt) {
+		at = append(at, t)
+	})
+	want := s.Start
+	for i, a := range s.Attempts {
+		want = want.Add(a.Delay)
+		if !at[i].Equal(want) {
+			t.Errorf("attempt %d replayed at %s, want %s", i+1, at[i], want)
+		}
+		want = want.Add(a.Duration)
+	}
+	if !clock.Now().Equal(want) {
+		t.Errorf("replay ended at %s, want %s", clock.Now(), want)
+	}
+}
+
+func TestRunningSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewSink(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempted := make(chan struct{}, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Backoff(sink, "forever", "unlimited", backoff.Config[int]{
+			Curve: func(float64) float64 { return 0.01 },
+			Func: func() (*int, error) {
+				attempted <- struct{}{}
+				return nil, errors.New("down")
+			},
+			Context:          ctx,
+			FractionalDelays: true,
+		})
+	}()
+
+	for i := 0; i < 3; i++ {
+		<-attempted
+	}
+
+	// The session never ends on its own, but its attempts are already on
+	// record.
+	sessions := readAll(t, path)
+	cancel()
+	<-done
+
+	if len(sessions) != 1 {
+		t.Fatalf("read %d sessions, want 1", len(sessions))
+	}
+	if s := sessions[0]; s.Outcome != OutcomeIncomplete || len(s.Attempts) < 2 {
+		t.Errorf("running session read as %q with %d attempts, want incomplete with at least 2", s.Outcome, len(s.Attempts))
+	}
+
+	sessions = readAll(t, path)
+	if len(sessions) != 1 || sessions[0].Outcome != OutcomeFailure {
+		t.Errorf("read %v after the session ended, want one failure", sessions)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewSink(path, 512, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 20; i++ {
+		err := sink.Write(Session{
+			Operation: strings.Repeat("x", 100),
+			Attempts:  []Attempt{{Number: 1}},
+			Outcome:   OutcomeFailure,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(p), err)
+		}
+		if info.Size() > 512 {
+			t.Errorf("%s is %d bytes, past the 512 byte limit", filepath.Base(p), info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept a third backup: %v", err)
+	}
+
+	// Read oldest first, sessions split by a rotation are whole again, except
+	// the first whose start may have been rotated away.
+	sessions := readAll(t, path+".2", path+".1", path)
+	if len(sessions) < 2 || len(sessions) >= 20 {
+		t.Fatalf("read %d sessions, want some but not all of 20", len(sessions))
+	}
+	for _, s := range sessions[1:] {
+		if s.Outcome == OutcomeIncomplete || len(s.Attempts) != 1 {
+			t.Errorf("read %q session with %d attempts, want whole sessions", s.Outcome, len(s.Attempts))
+		}
+	}
+}
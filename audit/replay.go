@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Record types, one per line of the log.
+const (
+	recordStart   = "start"
+	recordAttempt = "attempt"
+	recordEnd     = "end"
+)
+
+// record is a line of the log, holding part of a session.
+type record struct {
+	Session   string    `json:"session"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation,omitempty"`
+	Policy    string    `json:"policy,omitempty"`
+	Attempt   *Attempt  `json:"attempt,omitempty"`
+	Outcome   Outcome   `json:"outcome,omitempty"`
+	Errors    []string  `json:"errors,omitempty"`
+}
+
+func startRecord(s Session) record {
+	return record{Session: s.ID, Type: recordStart, Time: s.Start, Operation: s.Operation, Policy: s.Policy}
+}
+
+func attemptRecord(s Session, a Attempt) record {
+	return record{Session: s.ID, Type: recordAttempt, Time: a.Start, Attempt: &a}
+}
+
+func endRecord(s Session) record {
+	return record{Session: s.ID, Type: recordEnd, Time: s.End, Outcome: s.Outcome, Errors: s.Errors}
+}
+
+// Reader reads sessions written by a Sink.
+type Reader struct {
+	scanner *bufio.Scanner
+	// open holds the sessions which have not ended yet, and order their IDs
+	// in the order they started.
+	open  map[string]*Session
+	order []string
+}
+
+// NewReader returns a Reader reading JSON lines from r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	// Long error messages can exceed the default token size.
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &Reader{scanner: scanner, open: map[string]*Session{}}
+}
+
+// Next returns the next session, or io.EOF when there are no more. Sessions
+// are returned as they end, followed by any which had not ended by the end of
+// the log, with OutcomeIncomplete.
+func (r *Reader) Next() (Session, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return Session{}, err
+		}
+		if session, ended := r.add(rec); ended {
+			return session, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Session{}, err
+	}
+
+	if len(r.order) > 0 {
+		id := r.order[0]
+		r.order = r.order[1:]
+		session := r.open[id]
+		delete(r.open, id)
+		session.Outcome = OutcomeIncomplete
+		return *session, nil
+	}
+	return Session{}, io.EOF
+}
+
+// add applies rec to its session, returning the session if rec ended it.
+func (r *Reader) add(rec record) (Session, bool) {
+	session, ok := r.open[rec.Session]
+	if !ok {
+		session = &Session{ID: rec.Session}
+		r.open[rec.Session] = session
+		r.order = append(r.order, rec.Session)
+	}
+
+	switch rec.Type {
+	case recordStart:
+		session.Operation = rec.Operation
+		session.Policy = rec.Policy
+		session.Start = rec.Time
+	case recordAttempt:
+		if rec.Attempt != nil {
+			session.Attempts = append(session.Attempts, *rec.Attempt)
+		}
+	case recordEnd:
+		session.End = rec.Time
+		session.Outcome = rec.Outcome
+		session.Errors = rec.Errors
+
+		delete(r.open, rec.Session)
+		for i, id := range r.order {
+			if id == rec.Session {
+				r.order = append(r.order[:i], r.order[i+1:]...)
+				break
+			}
+		}
+		return *session, true
+	}
+	return Session{}, false
+}
+
+// Clock is the source of time used by Replay.
+type Clock interface {
+	Now() time.Time
+	Sleep(time.Duration)
+}
+
+// FakeClock is a Clock which only moves when slept on, so replays run
+// instantly.
+type FakeClock struct {
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to `start`.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	return c.now
+}
+
+// Sleep advances the clock by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// Replay reproduces the timeline of session on clock, calling fn with the
+// time each attempt is made. The clock waits out each attempt's delay before
+// the attempt and its duration after it, as the original session did.
+func Replay(session Session, clock Clock, fn func(at time.Time, attempt Attempt)) {
+	for _, attempt := range session.Attempts {
+		clock.Sleep(attempt.Delay)
+		if fn != nil {
+			fn(clock.Now(), attempt)
+		}
+		clock.Sleep(attempt.Duration)
+	}
+}
@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Sink appends sessions to a file as JSON lines, rotating the file once it
+// grows past a size limit.
+//
+// Rotated files are renamed by appending a number to the path, with 1 being
+// the most recent, eg. audit.log.1, audit.log.2. A session which is running
+// during a rotation is split between files, so to read it whole, read the
+// files oldest first through one Reader.
+type Sink struct {
+	// LogError, if not nil, is called with errors from writing sessions in
+	// Backoff, which does not otherwise report them.
+	LogError func(error)
+
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewSink opens the file at `path` for appending, creating it if needed.
+//
+// `maxBytes` is the size past which the file is rotated; if 0 it is never
+// rotated. `maxBackups` is how many rotated files are kept.
+func NewSink(path string, maxBytes int64, maxBackups int) (*Sink, error) {
+	s := &Sink{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends a finished session to the file, eg. one recorded elsewhere.
+// Sessions run through Backoff are written as they run instead.
+func (s *Sink) Write(session Session) error {
+	if session.ID == "" {
+		session.ID = newID()
+	}
+
+	records := []record{startRecord(session)}
+	for _, attempt := range session.Attempts {
+		records = append(records, attemptRecord(session, attempt))
+	}
+	if session.Outcome != OutcomeIncomplete {
+		records = append(records, endRecord(session))
+	}
+
+	for _, r := range records {
+		if err := s.write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends r to the file as a single line. The file is not buffered, so
+// the line survives the process crashing straight after.
+func (s *Sink) write(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close closes the underlying file.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *Sink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *Sink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	if s.maxBackups > 0 {
+		for i := s.maxBackups - 1; i > 0; i-- {
+			err := os.Rename(s.backup(i), s.backup(i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(s.path, s.backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+func (s *Sink) backup(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
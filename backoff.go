@@ -1,6 +1,10 @@
 package backoff
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 type Config[T any] struct {
 	// Curve should be a function that returns an increasing value based on the
@@ -8,6 +12,7 @@ type Config[T any] struct {
 	// before the next attempt.
 	//
 	// Eg. if Curve returns 10, the next attempt will be made in 10 seconds.
+	// Values are truncated to whole seconds unless FractionalDelays is set.
 	Curve func(float64) float64
 	// Func is the function that will be retried. It should return a value of
 	// type *T and/or an error. If the error is not nil, the function will be
@@ -15,76 +20,101 @@ type Config[T any] struct {
 	Func func() (*T, error)
 	// MaxAttempts is the maximum number of attempts to make before giving up.
 	// If MaxAttempts is 0 the function will be retried indefinitely, and errors
-	// will be logged but not returned.
+	// will be logged but not returned. Negative values make a single attempt.
 	MaxAttempts int
 	// If LogFailure is not nil, it will be called with the error returned by
 	// Func each time it fails.
 	LogFailure func(error)
+	// If Context is not nil, retrying stops as soon as it is done and the
+	// context's error is returned, even if MaxAttempts is 0. Any Override
+	// attached to it is applied on top of the config.
+	Context context.Context
+	// If Overload is not nil, it is checked before each retry and the retry is
+	// shed while it reports the process is overloaded. Shed retries count as
+	// attempts and are returned as ErrShed, without calling Func.
+	Overload OverloadSignal
+	// OverloadDelay is how long to wait for an overload to clear before
+	// shedding a retry. If 0, retries are shed straight away.
+	OverloadDelay time.Duration
+	// If Retryable is not nil, it is called with each error returned by Func,
+	// and retrying stops as soon as it returns false.
+	Retryable func(error) bool
+	// Cost is the cost of each attempt, used with CostBudget. Results and
+	// errors implementing Coster report their own cost instead.
+	Cost float64
+	// If FractionalDelays is true, fractions of a second returned by Curve
+	// are kept, so that 0.5 waits 500ms rather than not waiting at all.
+	FractionalDelays bool
+	// If CostBudget is not 0, retrying stops once another attempt would take
+	// the total cost over it, and ErrBudgetExhausted is returned.
+	CostBudget float64
 
 	Result T
 }
 
 // Backoff will retry the function specified in the config until it returns a
-// non-nil value or the maximum number of attempts is reached.
+// non-nil value, the maximum number of attempts is reached or the context is
+// done.
+//
+// Backoff is equivalent to calling Do with the options matching the config.
 func Backoff[T any](conf Config[T]) (*T, []error) {
-	if conf.Curve == nil || conf.Func == nil {
+	if conf.Func == nil {
 		return nil, []error{ErrInvalidConfig}
 	}
 
-	var errorChannel chan error
-	result := make(chan *T, 1)
-	errorList := []error{}
-
-	if conf.MaxAttempts != 0 {
-		errorChannel = make(chan error, conf.MaxAttempts)
+	ctx := conf.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	go backoff[T](conf.Curve, conf.Func, conf.MaxAttempts, result, errorChannel, conf.LogFailure)
-
-	res := <-result
+	res, err := Do(ctx, func(context.Context) (*T, error) {
+		return conf.Func()
+	}, conf.Options()...)
 	if res != nil {
 		return res, nil
 	}
 
-	for len(errorChannel) > 0 {
-		err := <-errorChannel
-		errorList = append(errorList, err)
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		return nil, retryErr.Errors
 	}
-
-	return nil, errorList
+	return nil, []error{err}
 }
 
-func backoff[T any](
-	curve func(float64) float64,
-	fn func() (*T, error),
-	attempts int,
-	result chan *T,
-	errors chan error,
-	logFailure func(error),
-) {
-	var res *T
-	attempt := 0
-
-	for attempts == 0 || attempt < attempts {
-		<-time.After(time.Duration(curve(float64(attempt))) * time.Second)
+// Options returns the Do options equivalent to the config, for helpers which
+// call Do themselves. Func and Context are not options, and are left out.
+func (conf Config[T]) Options() []Option {
+	opts := []Option{WithCurve(conf.Curve)}
 
-		var err error
-		res, err = fn()
+	if conf.MaxAttempts == 0 {
+		opts = append(opts, WithInfinite())
+	} else {
+		opts = append(opts, WithMaxAttempts(conf.MaxAttempts))
+	}
 
-		if err != nil {
-			if logFailure != nil {
+	if logFailure := conf.LogFailure; logFailure != nil {
+		opts = append(opts, WithHooks(Hooks{
+			OnFailure: func(_ int, err error) {
 				logFailure(err)
-			}
-			if attempts != 0 && errors != nil {
-				errors <- err
-			}
-		}
-		if res != nil {
-			// stop retrying
-			break
-		}
-		attempt++
+			},
+		}))
+	}
+
+	if conf.FractionalDelays {
+		opts = append(opts, WithFractionalDelays())
+	}
+
+	if conf.Overload != nil {
+		opts = append(opts, WithOverload(conf.Overload, conf.OverloadDelay))
+	}
+
+	if conf.Retryable != nil {
+		opts = append(opts, WithRetryable(conf.Retryable))
+	}
+
+	if conf.CostBudget != 0 {
+		opts = append(opts, WithCost(conf.Cost), WithCostBudget(conf.CostBudget))
 	}
 
-	result <- res
+	return opts
 }
@@ -0,0 +1,220 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func zero(float64) float64 { return 0 }
+
+// script returns a Func which returns the given results in turn, and a
+// pointer to the number of calls made.
+func script(results ...error) (func() (*int, error), *int) {
+	calls := 0
+	return func() (*int, error) {
+		err := results[calls]
+		calls++
+		if err == nil {
+			return &calls, nil
+		}
+		return nil, err
+	}, &calls
+}
+
+func TestBackoffReturnsEveryError(t *testing.T) {
+	e1, e2, e3 := errors.New("1"), errors.New("2"), errors.New("3")
+	fn, calls := script(e1, e2, e3)
+
+	res, errs := Backoff(Config[int]{Curve: zero, Func: fn, MaxAttempts: 3})
+	if res != nil {
+		t.Fatalf("res = %v, want nil", *res)
+	}
+	if fmt.Sprint(errs) != "[1 2 3]" {
+		t.Errorf("errs = %v, want [1 2 3]", errs)
+	}
+	if *calls != 3 {
+		t.Errorf("made %d calls, want 3", *calls)
+	}
+}
+
+func TestBackoffSucceeds(t *testing.T) {
+	fn, calls := script(errors.New("1"), nil)
+
+	var logged []error
+	res, errs := Backoff(Config[int]{
+		Curve:       zero,
+		Func:        fn,
+		MaxAttempts: 3,
+		LogFailure:  func(err error) { logged = append(logged, err) },
+	})
+	if res == nil || errs != nil {
+		t.Fatalf("Backoff = %v, %v, want a result and no errors", res, errs)
+	}
+	if *calls != 2 || len(logged) != 1 {
+		t.Errorf("made %d calls and logged %d errors, want 2 and 1", *calls, len(logged))
+	}
+}
+
+func TestBackoffInfinite(t *testing.T) {
+	fn, calls := script(errors.New("1"), errors.New("2"), errors.New("3"), nil)
+
+	var logged []error
+	res, errs := Backoff(Config[int]{
+		Curve:      zero,
+		Func:       fn,
+		LogFailure: func(err error) { logged = append(logged, err) },
+	})
+	if res == nil || errs != nil {
+		t.Fatalf("Backoff = %v, %v, want a result and no errors", res, errs)
+	}
+	if *calls != 4 {
+		t.Errorf("made %d calls, want 4", *calls)
+	}
+	// Errors are logged but not returned when retrying indefinitely.
+	if fmt.Sprint(logged) != "[1 2 3]" {
+		t.Errorf("logged %v, want [1 2 3]", logged)
+	}
+}
+
+func TestBackoffInvalidConfig(t *testing.T) {
+	fn, calls := script(nil)
+
+	for name, conf := range map[string]Config[int]{
+		"nil curve": {Func: fn, MaxAttempts: 1},
+		"nil func":  {Curve: zero, MaxAttempts: 1},
+	} {
+		res, errs := Backoff(conf)
+		if res != nil || len(errs) != 1 || errs[0] != ErrInvalidConfig {
+			t.Errorf("%s: Backoff = %v, %v, want [ErrInvalidConfig]", name, res, errs)
+		}
+	}
+	if *calls != 0 {
+		t.Errorf("made %d calls, want 0", *calls)
+	}
+}
+
+func TestBackoffResultWithError(t *testing.T) {
+	v := 1
+	var logged []error
+	res, errs := Backoff(Config[int]{
+		Curve:       zero,
+		Func:        func() (*int, error) { return &v, errors.New("partial") },
+		MaxAttempts: 3,
+		LogFailure:  func(err error) { logged = append(logged, err) },
+	})
+	// A result ends retrying even with an error, which is logged but not
+	// returned.
+	if res != &v || errs != nil {
+		t.Fatalf("Backoff = %v, %v, want the result and no errors", res, errs)
+	}
+	if len(logged) != 1 {
+		t.Errorf("logged %v, want the partial error", logged)
+	}
+}
+
+func TestBackoffNilResultWithoutError(t *testing.T) {
+	calls := 0
+	res, errs := Backoff(Config[int]{
+		Curve:       zero,
+		Func:        func() (*int, error) { calls++; return nil, nil },
+		MaxAttempts: 2,
+	})
+	if res != nil || len(errs) != 0 {
+		t.Fatalf("Backoff = %v, %v, want no result and no errors", res, errs)
+	}
+	if calls != 2 {
+		t.Errorf("made %d calls, want 2", calls)
+	}
+}
+
+func TestBackoffNegativeMaxAttempts(t *testing.T) {
+	fn, calls := script(errors.New("1"), errors.New("2"))
+
+	_, errs := Backoff(Config[int]{Curve: zero, Func: fn, MaxAttempts: -1})
+	if *calls != 1 || len(errs) != 1 {
+		t.Errorf("made %d calls with errors %v, want a single attempt", *calls, errs)
+	}
+}
+
+func TestBackoffContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, errs := Backoff(Config[int]{
+		Curve:            func(float64) float64 { return 0.01 },
+		Func:             func() (*int, error) { return nil, errors.New("fail") },
+		Context:          ctx,
+		FractionalDelays: true,
+	})
+	if len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Errorf("errs = %v, want only context.DeadlineExceeded", errs)
+	}
+}
+
+func TestDoStopReasons(t *testing.T) {
+	fail := errors.New("fail")
+	failing := func(context.Context) (*int, error) { return nil, fail }
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts []Option
+		want StopReason
+	}{
+		{"max attempts", context.Background(), []Option{WithMaxAttempts(2)}, StopMaxAttempts},
+		{"not retryable", context.Background(), []Option{WithRetryable(func(error) bool { return false })}, StopNotRetryable},
+		{"budget", context.Background(), []Option{WithCost(1), WithCostBudget(1.5)}, StopBudget},
+		{"shed", context.Background(), []Option{WithMaxAttempts(2), WithOverload(OverloadFunc(func() bool { return true }), 0)}, StopShed},
+		{"override", OverrideContext(context.Background(), Override{Disable: true}), []Option{WithInfinite()}, StopMaxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Do(tt.ctx, failing, append(tt.opts, WithCurve(zero))...)
+
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) {
+				t.Fatalf("Do = %v, want a RetryError", err)
+			}
+			if retryErr.Reason != tt.want {
+				t.Errorf("Reason = %q, want %q", retryErr.Reason, tt.want)
+			}
+			if !errors.Is(err, fail) {
+				t.Errorf("Do = %v, want it to wrap the attempt's error", err)
+			}
+		})
+	}
+}
+
+func TestOverloadZeroLimit(t *testing.T) {
+	var inFlight InFlight
+	done := inFlight.Start()
+	defer done()
+
+	for name, signal := range map[string]OverloadSignal{
+		"InFlight":    &inFlight,
+		"QueueLength": QueueLength{Len: func() int { return 1 }},
+		"Goroutines":  Goroutines{},
+	} {
+		if signal.Overloaded() {
+			t.Errorf("%s with no limit reports overload", name)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	curve := func(x float64) float64 { return 1.5 * x }
+
+	for attempt, want := range []time.Duration{0, time.Second, 3 * time.Second} {
+		if got := Delay(curve, attempt); got != want {
+			t.Errorf("Delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+	for attempt, want := range []time.Duration{0, 1500 * time.Millisecond, 3 * time.Second} {
+		if got := FractionalDelay(curve, attempt); got != want {
+			t.Errorf("FractionalDelay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package backofftest provides test helpers built on backoff, for waiting on
+// asynchronous effects without fixed sleeps.
+package backofftest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// deadlineGrace is how long before the test binary's deadline Eventually gives
+// up, leaving time to report the failure before the test is killed.
+const deadlineGrace = time.Second
+
+// Eventually polls condition under policy until it returns nil, and fails the
+// test if it never does.
+//
+// On failure the test is stopped with every attempt and its error listed. If
+// the test has a deadline, polling stops shortly before it so that the
+// failure is still reported, though condition is always checked at least
+// once.
+func Eventually(t testing.TB, condition func() error, policy backoff.Policy) {
+	t.Helper()
+
+	if report, ok := poll(t, condition, policy); !ok {
+		t.Fatal(report)
+	}
+}
+
+// EventuallyAsync polls condition under policy in the background and returns
+// straight away, for effects which must happen before the test ends but which
+// it need not wait on.
+//
+// The test's cleanup waits for polling to finish, which is bounded by policy
+// and the test's deadline as in Eventually, and fails the test with every
+// attempt listed if the condition was never met. condition is called from
+// another goroutine, so must be safe to call alongside the test.
+func EventuallyAsync(t testing.TB, condition func() error, policy backoff.Policy) {
+	t.Helper()
+
+	var report string
+	ok := false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		report, ok = poll(t, condition, policy)
+	}()
+
+	t.Cleanup(func() {
+		<-done
+		if !ok {
+			t.Error(report)
+		}
+	})
+}
+
+// poll runs condition under policy until it returns nil, bounded by the
+// test's deadline, and returns whether it did and otherwise the history of
+// attempts.
+func poll(t testing.TB, condition func() error, policy backoff.Policy) (string, bool) {
+	ctx := context.Background()
+	if d, ok := t.(interface{ Deadline() (time.Time, bool) }); ok {
+		if deadline, ok := d.Deadline(); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline.Add(-deadlineGrace))
+			defer cancel()
+		}
+	}
+	if ctx.Err() != nil {
+		// Too close to the deadline to poll, but the condition may hold
+		// already.
+		ctx = context.Background()
+		policy.Curve = func(float64) float64 { return 0 }
+		policy.MaxAttempts = 1
+	}
+
+	type attempt struct {
+		at  time.Duration
+		err error
+	}
+	var history []attempt
+	start := time.Now()
+
+	res, errs := backoff.Retry(ctx, policy, func() (*struct{}, error) {
+		err := condition()
+		history = append(history, attempt{at: time.Since(start), err: err})
+		if err != nil {
+			return nil, err
+		}
+		return &struct{}{}, nil
+	})
+	if res != nil {
+		return "", true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "condition not met after %d attempts in %s", len(history), time.Since(start).Round(time.Millisecond))
+	for i, a := range history {
+		fmt.Fprintf(&b, "\n  attempt %d at %s: %v", i+1, a.at.Round(time.Millisecond), a.err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(&b, "\nlast error: %v", errs[len(errs)-1])
+	}
+	return b.String(), false
+}
@@ -0,0 +1,172 @@
+package backofftest
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// fakeTB records failures instead of stopping the test.
+type fakeTB struct {
+	testing.TB
+	deadline time.Time
+	failure  string
+	failed   bool
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatal(args ...any) {
+	f.failed = true
+	for _, arg := range args {
+		f.failure += arg.(string)
+	}
+}
+
+func (f *fakeTB) Error(args ...any) {
+	f.Fatal(args...)
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+// cleanup runs the registered cleanups, last first, as testing does.
+func (f *fakeTB) cleanup() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func (f *fakeTB) Deadline() (time.Time, bool) {
+	return f.deadline, !f.deadline.IsZero()
+}
+
+func fastPolicy(attempts int) backoff.Policy {
+	return backoff.Policy{
+		Curve:            func(float64) float64 { return 0.01 },
+		MaxAttempts:      attempts,
+		FractionalDelays: true,
+	}
+}
+
+func TestEventuallySucceeds(t *testing.T) {
+	calls := 0
+	tb := &fakeTB{}
+	Eventually(tb, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, fastPolicy(5))
+
+	if tb.failed {
+		t.Fatalf("Eventually failed: %s", tb.failure)
+	}
+	if calls != 3 {
+		t.Errorf("polled %d times, want 3", calls)
+	}
+}
+
+func TestEventuallyFailure(t *testing.T) {
+	calls := 0
+	tb := &fakeTB{}
+	Eventually(tb, func() error {
+		calls++
+		return errors.New(strings.Repeat("x", calls))
+	}, fastPolicy(3))
+
+	if !tb.failed {
+		t.Fatal("Eventually did not fail")
+	}
+	for _, want := range []string{
+		"condition not met after 3 attempts",
+		"attempt 1 at ",
+		"attempt 3 at ",
+		"last error: xxx",
+	} {
+		if !strings.Contains(tb.failure, want) {
+			t.Errorf("failure %q does not contain %q", tb.failure, want)
+		}
+	}
+}
+
+func TestEventuallyDeadline(t *testing.T) {
+	tb := &fakeTB{deadline: time.Now().Add(deadlineGrace + 100*time.Millisecond)}
+
+	start := time.Now()
+	Eventually(tb, func() error {
+		return errors.New("never")
+	}, fastPolicy(0))
+
+	if !tb.failed {
+		t.Fatal("Eventually did not fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("polled for %s, past the deadline's grace period", elapsed)
+	}
+	if !strings.Contains(tb.failure, "context deadline exceeded") {
+		t.Errorf("failure %q does not mention the deadline", tb.failure)
+	}
+}
+
+func TestEventuallyPastDeadline(t *testing.T) {
+	tb := &fakeTB{deadline: time.Now().Add(deadlineGrace / 2)}
+
+	calls := 0
+	Eventually(tb, func() error {
+		calls++
+		return nil
+	}, fastPolicy(0))
+
+	if tb.failed {
+		t.Fatalf("Eventually failed: %s", tb.failure)
+	}
+	if calls != 1 {
+		t.Errorf("polled %d times, want 1", calls)
+	}
+}
+
+func TestEventuallyAsync(t *testing.T) {
+	var ready atomic.Bool
+	tb := &fakeTB{}
+	EventuallyAsync(tb, func() error {
+		if !ready.Load() {
+			return errors.New("not yet")
+		}
+		return nil
+	}, fastPolicy(100))
+
+	time.Sleep(30 * time.Millisecond)
+	ready.Store(true)
+	tb.cleanup()
+
+	if tb.failed {
+		t.Fatalf("EventuallyAsync failed: %s", tb.failure)
+	}
+}
+
+func TestEventuallyAsyncFailure(t *testing.T) {
+	tb := &fakeTB{}
+	EventuallyAsync(tb, func() error {
+		return errors.New("never")
+	}, fastPolicy(3))
+
+	if tb.failed {
+		t.Fatal("EventuallyAsync failed before cleanup")
+	}
+	tb.cleanup()
+
+	if !tb.failed {
+		t.Fatal("EventuallyAsync did not fail at cleanup")
+	}
+	if !strings.Contains(tb.failure, "condition not met after 3 attempts") {
+		t.Errorf("failure %q does not list the attempts", tb.failure)
+	}
+}
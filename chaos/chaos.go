@@ -0,0 +1,163 @@
+// Package chaos injects failures into retried functions, to check that retry
+// policies behave as expected when things go wrong.
+//
+// An Injector decides, either randomly or from a script, whether each call
+// fails with an error, is delayed, or panics. Injection can be switched on and
+// off globally with Enable and Disable, or per call chain with WithEnabled.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInjected is the error returned by injected failures when the Injector
+// has no Err set.
+var ErrInjected = errors.New("chaos: injected failure")
+
+// Fault is what happens to a single call.
+type Fault struct {
+	// Err, if not nil, is returned instead of calling the function.
+	Err error
+	// Latency is how long to wait before calling the function, or returning
+	// Err.
+	Latency time.Duration
+	// Panic, if not nil, is the value to panic with instead of calling the
+	// function.
+	Panic any
+}
+
+// Injector decides which faults to inject into calls.
+type Injector struct {
+	// Script, if not empty, lists the faults for each call in order. A zero
+	// Fault lets the call through untouched. Once the script runs out, faults
+	// are chosen randomly using the rates below.
+	Script []Fault
+
+	// ErrorRate is the probability, from 0 to 1, of returning Err.
+	ErrorRate float64
+	// Err is the error injected by ErrorRate. If nil, ErrInjected is used.
+	Err error
+	// LatencyRate is the probability, from 0 to 1, of waiting Latency before
+	// the call.
+	LatencyRate float64
+	// Latency is the delay injected by LatencyRate.
+	Latency time.Duration
+	// PanicRate is the probability, from 0 to 1, of panicking.
+	PanicRate float64
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	calls int
+}
+
+// New returns an Injector whose random choices are determined by `seed`, so
+// that a run can be reproduced.
+func New(seed int64) *Injector {
+	return &Injector{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Next returns the fault for the next call.
+func (i *Injector) Next() Fault {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	call := i.calls
+	i.calls++
+	if call < len(i.Script) {
+		return i.Script[call]
+	}
+
+	if i.rng == nil {
+		i.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	// Every rate is rolled on every call, so that the sequence of random
+	// numbers, and therefore the run, only depends on the seed.
+	latency, fail, panics := i.rng.Float64(), i.rng.Float64(), i.rng.Float64()
+
+	var fault Fault
+	if latency < i.LatencyRate {
+		fault.Latency = i.Latency
+	}
+	if panics < i.PanicRate {
+		fault.Panic = ErrInjected
+	} else if fail < i.ErrorRate {
+		fault.Err = i.Err
+		if fault.Err == nil {
+			fault.Err = ErrInjected
+		}
+	}
+	return fault
+}
+
+// Reset starts the script over. Random choices continue from where they were.
+func (i *Injector) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.calls = 0
+}
+
+// Wrap returns fn with faults from inj injected into each call, while
+// injection is enabled globally. It can be used as a Config's Func.
+func Wrap[T any](inj *Injector, fn func() (*T, error)) func() (*T, error) {
+	return WrapContext(context.Background(), inj, fn)
+}
+
+// WrapContext is like Wrap, but injection also follows any setting made on
+// ctx with WithEnabled, which takes precedence over the global switch.
+func WrapContext[T any](ctx context.Context, inj *Injector, fn func() (*T, error)) func() (*T, error) {
+	return func() (*T, error) {
+		if !Enabled(ctx) {
+			return fn()
+		}
+
+		fault := inj.Next()
+		if fault.Latency > 0 {
+			time.Sleep(fault.Latency)
+		}
+		if fault.Panic != nil {
+			panic(fault.Panic)
+		}
+		if fault.Err != nil {
+			return nil, fault.Err
+		}
+		return fn()
+	}
+}
+
+var enabled atomic.Bool
+
+func init() {
+	enabled.Store(true)
+}
+
+// Enable switches injection on globally. Injection is on by default.
+func Enable() {
+	enabled.Store(true)
+}
+
+// Disable switches injection off globally.
+func Disable() {
+	enabled.Store(false)
+}
+
+type contextKey struct{}
+
+// WithEnabled returns a copy of ctx which switches injection on or off for
+// functions wrapped with it, regardless of the global switch.
+func WithEnabled(ctx context.Context, on bool) context.Context {
+	return context.WithValue(ctx, contextKey{}, on)
+}
+
+// Enabled reports whether faults are injected for ctx.
+func Enabled(ctx context.Context) bool {
+	if on, ok := ctx.Value(contextKey{}).(bool); ok {
+		return on
+	}
+	return enabled.Load()
+}
@@ -0,0 +1,116 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/zaptross/backoff"
+)
+
+func faults(inj *Injector, n int) []Fault {
+	var fs []Fault
+	for i := 0; i < n; i++ {
+		fs = append(fs, inj.Next())
+	}
+	return fs
+}
+
+func TestSeedDeterministic(t *testing.T) {
+	newInjector := func(seed int64) *Injector {
+		inj := New(seed)
+		inj.ErrorRate = 0.3
+		inj.LatencyRate = 0.2
+		inj.PanicRate = 0.1
+		return inj
+	}
+
+	a := fmt.Sprint(faults(newInjector(42), 200))
+	b := fmt.Sprint(faults(newInjector(42), 200))
+	if a != b {
+		t.Error("injectors with the same seed chose different faults")
+	}
+	if c := fmt.Sprint(faults(newInjector(43), 200)); a == c {
+		t.Error("injectors with different seeds chose the same faults")
+	}
+}
+
+func TestRatesDoNotShiftRolls(t *testing.T) {
+	// Switching on latency must not change which calls fail, as every rate
+	// is rolled on every call.
+	errorsOnly := New(7)
+	errorsOnly.ErrorRate = 0.5
+	withLatency := New(7)
+	withLatency.ErrorRate = 0.5
+	withLatency.LatencyRate = 0.5
+
+	for i := 0; i < 200; i++ {
+		a, b := errorsOnly.Next(), withLatency.Next()
+		if (a.Err == nil) != (b.Err == nil) {
+			t.Fatalf("call %d: error injected in one run only", i)
+		}
+	}
+}
+
+func TestScript(t *testing.T) {
+	fail := errors.New("scripted")
+	inj := New(1)
+	inj.Script = []Fault{{Err: fail}, {}}
+
+	got := faults(inj, 3)
+	if got[0].Err != fail || got[1] != (Fault{}) || got[2] != (Fault{}) {
+		t.Errorf("faults = %v, want the script then none at zero rates", got)
+	}
+
+	inj.Reset()
+	if f := inj.Next(); f.Err != fail {
+		t.Errorf("after Reset, fault = %v, want the script again", f)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	inj := New(1)
+	inj.Script = []Fault{{Err: ErrInjected}, {Err: ErrInjected}}
+
+	value := 1
+	res, errs := backoff.Backoff(backoff.Config[int]{
+		Curve:       func(float64) float64 { return 0 },
+		Func:        Wrap(inj, func() (*int, error) { return &value, nil }),
+		MaxAttempts: 3,
+	})
+	if res == nil || len(errs) != 0 {
+		t.Fatalf("Backoff = %v, %v, want success on the third attempt", res, errs)
+	}
+
+	inj.Reset()
+	off := WrapContext(WithEnabled(context.Background(), false), inj, func() (*int, error) { return &value, nil })
+	if res, err := off(); res == nil || err != nil {
+		t.Errorf("disabled by context = %v, %v, want the call through", res, err)
+	}
+}
+
+func TestWrapPanic(t *testing.T) {
+	inj := New(1)
+	inj.Script = []Fault{{Panic: "injected"}}
+
+	defer func() {
+		if r := recover(); r != "injected" {
+			t.Errorf("recovered %v, want the injected panic", r)
+		}
+	}()
+	Wrap(inj, func() (*int, error) { return nil, nil })()
+	t.Error("call did not panic")
+}
+
+func TestGlobalSwitch(t *testing.T) {
+	defer Enable()
+
+	Disable()
+	if Enabled(context.Background()) {
+		t.Error("enabled after Disable")
+	}
+	if !Enabled(WithEnabled(context.Background(), true)) {
+		t.Error("context setting did not take precedence over Disable")
+	}
+}
@@ -0,0 +1,149 @@
+// Package classify decides whether errors are transient and worth retrying.
+//
+// Classifiers are plain functions which can be combined with And, Or and Not,
+// and passed as Config.Retryable or to backoff.WithRetryable. Transient
+// combines all of them with sensible defaults.
+//
+// Classifiers for gRPC and SQL errors recognise errors from the common
+// drivers by their methods and fields, so this package does not depend on
+// any of them.
+package classify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// Classifier reports whether an error is transient.
+type Classifier func(error) bool
+
+// And returns a Classifier matching errors which all of cs match.
+func And(cs ...Classifier) Classifier {
+	return func(err error) bool {
+		for _, c := range cs {
+			if !c(err) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a Classifier matching errors which any of cs match.
+func Or(cs ...Classifier) Classifier {
+	return func(err error) bool {
+		for _, c := range cs {
+			if c(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a Classifier matching errors which c does not match.
+func Not(c Classifier) Classifier {
+	return func(err error) bool {
+		return !c(err)
+	}
+}
+
+// Transient matches errors which are transient according to the Network,
+// Context, Temporary, HTTPStatus, GRPCCode and SQLState classifiers, using
+// their default codes.
+func Transient(err error) bool {
+	return transient(err)
+}
+
+var transient = Or(
+	Network,
+	Context,
+	Temporary,
+	HTTPStatus(RetryableHTTPStatuses...),
+	GRPCCode(RetryableGRPCCodes...),
+	SQLState(RetryableSQLStates...),
+)
+
+// networkErrnos are the socket errors which usually clear up on their own.
+var networkErrnos = []syscall.Errno{
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.EPIPE,
+	syscall.ETIMEDOUT,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+	syscall.ENETDOWN,
+}
+
+// Network matches timeouts, refused and reset connections, unreachable hosts
+// and networks, connections closed mid-response, and temporary DNS failures.
+func Network(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, errno := range networkErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Context matches context.DeadlineExceeded, as a deadline for one attempt
+// does not mean the next will also run out of time. context.Canceled is never
+// matched, as it means the caller has stopped waiting.
+func Context(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled)
+}
+
+// Temporary matches errors with a Temporary or Timeout method returning true,
+// such as those from the net package.
+func Temporary(err error) bool {
+	return walk(err, func(err error) bool {
+		if t, ok := err.(interface{ Temporary() bool }); ok && t.Temporary() {
+			return true
+		}
+		if t, ok := err.(interface{ Timeout() bool }); ok && t.Timeout() {
+			return true
+		}
+		return false
+	})
+}
+
+// walk calls fn with err and every error it wraps, stopping when fn returns
+// true.
+func walk(err error, fn func(error) bool) bool {
+	if err == nil {
+		return false
+	}
+	if fn(err) {
+		return true
+	}
+
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return walk(u.Unwrap(), fn)
+	case interface{ Unwrap() []error }:
+		for _, inner := range u.Unwrap() {
+			if walk(inner, fn) {
+				return true
+			}
+		}
+	}
+	return false
+}
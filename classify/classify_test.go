@@ -0,0 +1,110 @@
+package classify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// grpcCodes, grpcStatus and grpcError mirror the shapes of codes.Code,
+// status.Status and the error from status.Error.
+type grpcCodes uint32
+
+type grpcStatus struct{ code grpcCodes }
+
+func (s *grpcStatus) Code() grpcCodes { return s.code }
+
+type grpcError struct{ status *grpcStatus }
+
+func (e *grpcError) Error() string           { return "rpc error" }
+func (e *grpcError) GRPCStatus() *grpcStatus { return e.status }
+
+func grpcErr(code Code) error {
+	return &grpcError{&grpcStatus{grpcCodes(code)}}
+}
+
+// mysqlError mirrors mysql.MySQLError, whose SQLSTATE is a field.
+type mysqlError struct {
+	Number   uint16
+	SQLState [5]byte
+	Message  string
+}
+
+func (e *mysqlError) Error() string { return "mysql error" }
+
+func mysqlErr(state string) error {
+	e := &mysqlError{}
+	copy(e.SQLState[:], state)
+	return e
+}
+
+// pgError mirrors the pgx and lib/pq errors, whose SQLSTATE is a method.
+type pgError struct{ code string }
+
+func (e pgError) Error() string    { return "pg error" }
+func (e pgError) SQLState() string { return e.code }
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("bad request"), false},
+		{"connection refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"unexpected EOF", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), true},
+		{"dns timeout", &net.DNSError{IsTimeout: true}, true},
+		{"dns not found", &net.DNSError{IsNotFound: true}, false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"http 503", &StatusError{Code: 503}, true},
+		{"http 404", fmt.Errorf("get: %w", &StatusError{Code: 404}), false},
+		{"grpc unavailable", grpcErr(CodeUnavailable), true},
+		{"grpc wrapped", fmt.Errorf("call: %w", grpcErr(CodeAborted)), true},
+		{"grpc internal", grpcErr(CodeInternal), false},
+		{"grpc nil status", &grpcError{}, false},
+		{"pg serialization", pgError{"40001"}, true},
+		{"pg unique violation", pgError{"23505"}, false},
+		{"mysql connection class", mysqlErr("08S01"), true},
+		{"mysql joined", errors.Join(errors.New("tx"), mysqlErr("40001")), true},
+		{"mysql syntax", mysqlErr("42000"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Transient(tt.err); got != tt.want {
+				t.Errorf("Transient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	if !Context(fmt.Errorf("attempt: %w", context.DeadlineExceeded)) {
+		t.Error("deadline not matched")
+	}
+	if Context(errors.Join(context.Canceled, context.DeadlineExceeded)) {
+		t.Error("deadline matched alongside cancellation")
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	internal := GRPCCode(CodeInternal)
+	c := And(Or(Transient, internal), Not(HTTPStatus(503)))
+
+	if !c(grpcErr(CodeInternal)) {
+		t.Error("custom code not matched")
+	}
+	if c(&StatusError{Code: 503}) {
+		t.Error("excluded status matched")
+	}
+	if !c(&StatusError{Code: 502}) {
+		t.Error("transient status not matched")
+	}
+}
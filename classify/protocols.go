@@ -0,0 +1,187 @@
+package classify
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// RetryableHTTPStatuses are the status codes matched by Transient.
+var RetryableHTTPStatuses = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooEarly,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// StatusError is an error for an HTTP response with an unsuccessful status,
+// for clients which do not already have one.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http status %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// StatusCode returns the response's status code.
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// HTTPStatus returns a Classifier matching errors with a StatusCode method
+// returning one of `codes`, such as StatusError.
+func HTTPStatus(codes ...int) Classifier {
+	return func(err error) bool {
+		return walk(err, func(err error) bool {
+			s, ok := err.(interface{ StatusCode() int })
+			if !ok {
+				return false
+			}
+			for _, code := range codes {
+				if s.StatusCode() == code {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
+// Code is a gRPC status code, with the same values as codes.Code from
+// google.golang.org/grpc/codes.
+type Code uint32
+
+const (
+	CodeCanceled          Code = 1
+	CodeUnknown           Code = 2
+	CodeDeadlineExceeded  Code = 4
+	CodeResourceExhausted Code = 8
+	CodeAborted           Code = 10
+	CodeInternal          Code = 13
+	CodeUnavailable       Code = 14
+)
+
+// RetryableGRPCCodes are the gRPC codes matched by Transient.
+var RetryableGRPCCodes = []Code{
+	CodeDeadlineExceeded,
+	CodeResourceExhausted,
+	CodeAborted,
+	CodeUnavailable,
+}
+
+// GRPCCode returns a Classifier matching gRPC status errors with one of
+// `codes`. Status errors are recognised by their GRPCStatus method, as
+// implemented by errors from google.golang.org/grpc/status.
+func GRPCCode(codes ...Code) Classifier {
+	return func(err error) bool {
+		return walk(err, func(err error) bool {
+			code, ok := grpcCode(err)
+			if !ok {
+				return false
+			}
+			for _, c := range codes {
+				if code == c {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
+// grpcCode calls err.GRPCStatus().Code() through reflection, as the types
+// involved belong to the grpc module.
+func grpcCode(err error) (Code, bool) {
+	method := reflect.ValueOf(err).MethodByName("GRPCStatus")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return 0, false
+	}
+	status := method.Call(nil)[0]
+	if status.Kind() == reflect.Pointer && status.IsNil() {
+		return 0, false
+	}
+
+	code := status.MethodByName("Code")
+	if !code.IsValid() || code.Type().NumIn() != 0 || code.Type().NumOut() != 1 {
+		return 0, false
+	}
+	value := code.Call(nil)[0]
+	if value.Kind() != reflect.Uint32 {
+		return 0, false
+	}
+	return Code(value.Uint()), true
+}
+
+// RetryableSQLStates are the SQLSTATE codes and classes matched by Transient:
+// connection exceptions, serialization failures, deadlocks, too many
+// connections, and the server shutting down.
+var RetryableSQLStates = []string{
+	"08",
+	"40001",
+	"40P01",
+	"53300",
+	"57P01",
+	"57P02",
+	"57P03",
+}
+
+// SQLState returns a Classifier matching database errors whose SQLSTATE starts
+// with one of `states`, so that a two character class such as "08" matches
+// every code in it.
+//
+// The SQLSTATE is read from a SQLState method, as on PostgreSQL errors from
+// pgx and lib/pq, or from a SQLState field, as on MySQL errors from
+// go-sql-driver/mysql.
+func SQLState(states ...string) Classifier {
+	return func(err error) bool {
+		return walk(err, func(err error) bool {
+			code := sqlState(err)
+			if code == "" {
+				return false
+			}
+			for _, state := range states {
+				if strings.HasPrefix(code, state) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
+func sqlState(err error) string {
+	if s, ok := err.(interface{ SQLState() string }); ok {
+		return s.SQLState()
+	}
+
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	field := v.FieldByName("SQLState")
+	switch {
+	case !field.IsValid():
+		return ""
+	case field.Kind() == reflect.String:
+		return field.String()
+	case field.Kind() == reflect.Array && field.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, field.Len())
+		for i := range b {
+			b[i] = byte(field.Index(i).Uint())
+		}
+		return string(b)
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zaptross/backoff/policyfile"
+)
+
+type lintResult struct {
+	File string `json:"file"`
+	policyfile.Finding
+}
+
+// runLint checks each policy file given and exits with 1 if any finding is an
+// error, or the files could not be read.
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	maxTotal := fs.Duration("max-total", 0, "flag policies which may take longer than this to give up (0 disables)")
+	horizon := fs.Int("horizon", 100, "attempts of infinite policies to examine")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: backoff lint [flags] file...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || (*format != "text" && *format != "json") {
+		fs.Usage()
+		return 2
+	}
+
+	opts := policyfile.LintOptions{MaxTotal: *maxTotal, Horizon: *horizon}
+	results := []lintResult{}
+	exit := 0
+
+	for _, path := range fs.Args() {
+		f, err := policyfile.Load(path)
+		if err != nil {
+			results = append(results, lintResult{File: path, Finding: policyfile.Finding{
+				Rule:     policyfile.RuleInvalid,
+				Severity: policyfile.SeverityError,
+				Message:  err.Error(),
+			}})
+			exit = 1
+			continue
+		}
+
+		for _, p := range f.Policies {
+			for _, finding := range policyfile.Lint(p, opts) {
+				results = append(results, lintResult{File: path, Finding: finding})
+				if finding.Severity == policyfile.SeverityError {
+					exit = 1
+				}
+			}
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintln(os.Stderr, "backoff lint:", err)
+			return 1
+		}
+		return exit
+	}
+
+	for _, r := range results {
+		fmt.Printf("%s: %s: %s [%s] %s\n", r.File, r.Policy, r.Severity, r.Rule, r.Message)
+	}
+	return exit
+}
@@ -0,0 +1,53 @@
+// Command backoff provides tools for working with retry policies.
+//
+// Usage:
+//
+//	backoff <command> [flags] [args]
+//
+// The commands are:
+//
+//	lint       check policy files for dangerous settings
+//	supervise  keep a command running, restarting it with backoff
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"lint", "check policy files for dangerous settings", runLint},
+	{"supervise", "keep a command running, restarting it with backoff", runSupervise},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "backoff: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: backoff <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+}
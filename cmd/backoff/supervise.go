@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+
+	"github.com/zaptross/backoff"
+	"github.com/zaptross/backoff/policyfile"
+	"github.com/zaptross/backoff/supervise"
+)
+
+// runSupervise keeps the command after the flags running until it is sent a
+// stop signal or restarts too many times.
+func runSupervise(args []string) int {
+	fs := flag.NewFlagSet("supervise", flag.ExitOnError)
+	policyPath := fs.String("policy", "", "policy file to take the restart curve and max restarts from")
+	policyName := fs.String("name", "", "name of the policy to use from the policy file (default the first)")
+	maxDelay := fs.Duration("max-delay", 0, "longest delay between restarts when no policy file is given (default 1m)")
+	maxRestarts := fs.Int("max-restarts", 0, "consecutive restarts without a healthy run after which to give up, when no policy file is given (0 is unlimited)")
+	healthy := fs.Duration("healthy", 0, "uptime after which the restart curve starts over (0 never)")
+	logPath := fs.String("log", "-", "file to append restart events to, or - for stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: backoff supervise [flags] -- command [args...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	curve, restarts, err := supervisePolicy(*policyPath, *policyName, *maxDelay, *maxRestarts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "backoff supervise:", err)
+		return 2
+	}
+
+	var log io.Writer = os.Stderr
+	if *logPath != "-" {
+		f, err := os.OpenFile(*logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "backoff supervise:", err)
+			return 1
+		}
+		defer f.Close()
+		log = f
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	name, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	err = supervise.Run(context.Background(), supervise.Config{
+		Command: func() *exec.Cmd {
+			cmd := exec.Command(name, cmdArgs...)
+			cmd.Stdin = os.Stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			return cmd
+		},
+		Curve:        curve,
+		MaxRestarts:  restarts,
+		HealthyAfter: *healthy,
+		Signals:      signals,
+		Log:          log,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "backoff supervise:", err)
+		return 1
+	}
+	return 0
+}
+
+// supervisePolicy returns the restart curve and maximum number of restarts,
+// from the named policy in a policy file, or doubling the delay from one
+// second up to maxDelay if there is no file.
+//
+// A policy's MaxAttempts counts the first run, so it allows one restart fewer;
+// a policy making a single attempt is never restarted. Like -max-restarts, the
+// limit applies to consecutive restarts, starting over after a healthy run.
+func supervisePolicy(path, name string, maxDelay time.Duration, maxRestarts int) (func(float64) float64, int, error) {
+	if path == "" {
+		if maxDelay == 0 {
+			maxDelay = time.Minute
+		}
+		curve := func(x float64) float64 {
+			return math.Min(backoff.Exponential(x, 2, 1), maxDelay.Seconds())
+		}
+		return curve, maxRestarts, nil
+	}
+
+	f, err := policyfile.Load(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, p := range f.Policies {
+		if name != "" && p.Name != name {
+			continue
+		}
+		policy, err := p.Backoff()
+		if err != nil {
+			return nil, 0, err
+		}
+		switch {
+		case policy.MaxAttempts == 0:
+			return policy.Curve, 0, nil
+		case policy.MaxAttempts == 1:
+			return policy.Curve, supervise.NoRestarts, nil
+		}
+		return policy.Curve, policy.MaxAttempts - 1, nil
+	}
+	if name == "" {
+		return nil, 0, fmt.Errorf("%s: no policies", path)
+	}
+	return nil, 0, fmt.Errorf("%s: no policy named %q", path, name)
+}
@@ -0,0 +1,80 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+)
+
+// Coster is implemented by results and errors which know what the attempt
+// that returned them cost, eg. a paid API response reporting its charge.
+type Coster interface {
+	Cost() float64
+}
+
+// WithCost sets the cost of each attempt, for attempts which do not report
+// their own cost.
+func WithCost(cost float64) Option {
+	return func(o *options) {
+		o.cost = cost
+	}
+}
+
+// WithCostBudget stops retrying, with StopBudget as the reason, once another
+// attempt would take the total cost of all attempts over `budget`. The budget
+// applies alongside the maximum number of attempts; whichever runs out first
+// ends retrying.
+//
+// When attempts report their own cost, the next attempt is assumed to cost
+// the amount set with WithCost, so retrying stops once the budget is spent.
+func WithCostBudget(budget float64) Option {
+	return func(o *options) {
+		o.costBudget = budget
+	}
+}
+
+// ReportCost records the cost of the current attempt, from within the
+// function passed to Do. It takes precedence over a Coster result or error
+// and over WithCost. It has no effect when ctx did not come from Do.
+func ReportCost(ctx context.Context, cost float64) {
+	if meter, ok := ctx.Value(costKey{}).(*costMeter); ok {
+		meter.cost = cost
+		meter.reported = true
+	}
+}
+
+type costKey struct{}
+
+// costMeter receives the cost reported during an attempt.
+type costMeter struct {
+	cost     float64
+	reported bool
+}
+
+func (m *costMeter) reset() {
+	m.cost = 0
+	m.reported = false
+}
+
+// attemptCost returns the cost of an attempt from, in order of precedence,
+// ReportCost, a Coster result or error, or WithCost.
+func (o *options) attemptCost(meter *costMeter, res any, err error) float64 {
+	if meter.reported {
+		return meter.cost
+	}
+	if c, ok := res.(Coster); ok {
+		return c.Cost()
+	}
+	var c Coster
+	if errors.As(err, &c) {
+		return c.Cost()
+	}
+	return o.cost
+}
+
+// overBudget reports whether another attempt would exceed the budget.
+func (o *options) overBudget(spent float64) bool {
+	if o.costBudget <= 0 {
+		return false
+	}
+	return spent >= o.costBudget || spent+o.cost > o.costBudget
+}
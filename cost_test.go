@@ -0,0 +1,100 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// costError is a failure which knows what the attempt cost.
+type costError float64
+
+func (e costError) Error() string { return "costly failure" }
+func (e costError) Cost() float64 { return float64(e) }
+
+func TestCostBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		fn     func(context.Context) (*int, error)
+		opts   []Option
+		want   int
+		reason StopReason
+	}{
+		{
+			name:   "fixed cost",
+			fn:     func(context.Context) (*int, error) { return nil, errors.New("fail") },
+			opts:   []Option{WithCost(1), WithCostBudget(2.5)},
+			want:   2,
+			reason: StopBudget,
+		},
+		{
+			name:   "coster error",
+			fn:     func(context.Context) (*int, error) { return nil, costError(3) },
+			opts:   []Option{WithCostBudget(5)},
+			want:   2,
+			reason: StopBudget,
+		},
+		{
+			name: "reported",
+			fn: func(ctx context.Context) (*int, error) {
+				ReportCost(ctx, 5)
+				return nil, costError(1)
+			},
+			opts:   []Option{WithCost(1), WithCostBudget(6)},
+			want:   2,
+			reason: StopBudget,
+		},
+		{
+			name: "free attempts",
+			fn: func(ctx context.Context) (*int, error) {
+				ReportCost(ctx, 0)
+				return nil, costError(10)
+			},
+			opts:   []Option{WithCostBudget(1), WithMaxAttempts(4)},
+			want:   4,
+			reason: StopMaxAttempts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			fn := func(ctx context.Context) (*int, error) {
+				calls++
+				return tt.fn(ctx)
+			}
+			opts := append([]Option{WithCurve(zero), WithMaxAttempts(10)}, tt.opts...)
+			_, err := Do(context.Background(), fn, opts...)
+			if calls != tt.want {
+				t.Errorf("made %d attempts, want %d", calls, tt.want)
+			}
+
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) {
+				t.Fatalf("Do = %v, want a RetryError", err)
+			}
+			if retryErr.Reason != tt.reason {
+				t.Errorf("Reason = %q, want %q", retryErr.Reason, tt.reason)
+			}
+			if tt.reason == StopBudget && !errors.Is(err, ErrBudgetExhausted) {
+				t.Errorf("Do = %v, want it to wrap ErrBudgetExhausted", err)
+			}
+		})
+	}
+}
+
+func TestReportCostOutsideDo(t *testing.T) {
+	// Without a meter from Do, reporting is ignored rather than panicking.
+	ReportCost(context.Background(), 1)
+}
+
+func TestConfigCostBudget(t *testing.T) {
+	f, calls := script(errors.New("a"), errors.New("b"), errors.New("c"), nil)
+	_, errs := Backoff(Config[int]{Curve: zero, Func: f, MaxAttempts: 5, Cost: 1, CostBudget: 2})
+	if *calls != 2 {
+		t.Errorf("made %d attempts, want 2", *calls)
+	}
+	if len(errs) == 0 || !errors.Is(errs[len(errs)-1], ErrBudgetExhausted) {
+		t.Errorf("errors = %v, want ErrBudgetExhausted last", errs)
+	}
+}
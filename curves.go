@@ -1,6 +1,10 @@
 package backoff
 
-import "math"
+import (
+	"math"
+	"math/rand"
+	"time"
+)
 
 // Default is the recommended default curve for backoff. It is a logistic curve
 // which generates values in a sigmoid or S-curve shape based on the maximum
@@ -32,3 +36,38 @@ func Logistic(x, k, L, x0 float64) float64 {
 func Linear(x float64, mul float64) float64 {
 	return x * mul
 }
+
+// Exponential is a function that returns a value based on an exponential
+// function. It generates values which grow by a factor of `base` each step.
+//
+// `x` is the input value.
+// `base` is the growth factor.
+// `mul` is the multiplier, and the value when x is 0.
+func Exponential(x, base, mul float64) float64 {
+	return mul * math.Pow(base, x)
+}
+
+// Delay returns how long Backoff waits before the given attempt, counting
+// from 0, when using curve. Curve values are truncated to whole seconds.
+func Delay(curve func(float64) float64, attempt int) time.Duration {
+	return time.Duration(curve(float64(attempt))) * time.Second
+}
+
+// FractionalDelay is Delay keeping fractions of a second, as Backoff waits
+// with Config.FractionalDelays set.
+func FractionalDelay(curve func(float64) float64, attempt int) time.Duration {
+	return time.Duration(curve(float64(attempt)) * float64(time.Second))
+}
+
+// Jitter wraps curve so that each value is randomly reduced by up to `factor`
+// of itself, spreading out retries from many clients which started failing
+// at the same time.
+//
+// Eg. with a factor of 0.5, a curve value of 10 becomes a value between 5 and
+// 10. Jitter on small curves is lost to truncation unless fractional delays
+// are enabled.
+func Jitter(curve func(float64) float64, factor float64) func(float64) float64 {
+	return func(x float64) float64 {
+		return curve(x) * (1 - factor*rand.Float64())
+	}
+}
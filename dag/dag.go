@@ -0,0 +1,298 @@
+// Package dag runs a graph of dependent tasks with bounded parallelism,
+// retrying each task under its own policy.
+//
+// A node runs once all of its dependencies have succeeded. If a node fails
+// for good, every node depending on it, directly or not, is skipped, while
+// unrelated branches carry on.
+package dag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// ErrCycle is returned when the nodes' dependencies form a cycle.
+var ErrCycle = errors.New("dag: dependency cycle")
+
+// Node is a task in the graph.
+type Node struct {
+	ID string
+	// Deps are the IDs of the nodes which must succeed before this one runs.
+	Deps []string
+	// Run performs the task.
+	Run func(ctx context.Context) error
+	// Policy is used to retry Run.
+	Policy backoff.Policy
+}
+
+// Status is how a node ended.
+type Status string
+
+const (
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	// StatusSkipped nodes did not run because a dependency failed.
+	StatusSkipped Status = "skipped"
+	// StatusCancelled nodes did not run, or were stopped, because ctx was
+	// done.
+	StatusCancelled Status = "cancelled"
+)
+
+// Outcome is the result of a single node.
+type Outcome struct {
+	ID       string
+	Status   Status
+	Attempts int
+	Start    time.Time
+	End      time.Time
+	// Err is the node's RetryError if it failed or was stopped.
+	Err error
+	// Dependents are the outcomes of the nodes depending on this one, so
+	// that following them from the roots gives the outcome tree. Nodes with
+	// several dependencies appear under each of them.
+	Dependents []*Outcome
+}
+
+// Report holds the outcome of every node.
+type Report struct {
+	// Outcomes maps node IDs to their outcome.
+	Outcomes map[string]*Outcome
+	// Roots are the outcomes of the nodes without dependencies.
+	Roots []*Outcome
+}
+
+// Failed returns the IDs of the nodes which failed, in order.
+func (r *Report) Failed() []string {
+	var failed []string
+	for id, o := range r.Outcomes {
+		if o.Status == StatusFailed {
+			failed = append(failed, id)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// WriteTree writes the outcome tree to w, one node per line, indented under
+// the nodes it depends on.
+func (r *Report) WriteTree(w io.Writer) error {
+	var write func(o *Outcome, depth int) error
+	write = func(o *Outcome, depth int) error {
+		line := fmt.Sprintf("%s%s: %s", strings.Repeat("  ", depth), o.ID, o.Status)
+		if o.Attempts > 0 {
+			line += fmt.Sprintf(" after %d attempts", o.Attempts)
+		}
+		if o.Err != nil && o.Status == StatusFailed {
+			line += fmt.Sprintf(" (%v)", o.Err)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		for _, d := range o.Dependents {
+			if err := write(d, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, root := range r.Roots {
+		if err := write(root, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Error is returned by Run when any node failed.
+type Error struct {
+	Failed []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dag: %d nodes failed: %s", len(e.Failed), strings.Join(e.Failed, ", "))
+}
+
+type result struct {
+	id       string
+	attempts int
+	start    time.Time
+	end      time.Time
+	err      error
+}
+
+// Run executes the nodes, running at most `parallelism` at once, and reports
+// the outcome of each. It returns an *Error if any node failed, ctx's error
+// if ctx was done first, or an error if the graph is invalid.
+func Run(ctx context.Context, nodes []Node, parallelism int) (*Report, error) {
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	byID, dependents, err := build(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Outcomes: map[string]*Outcome{}}
+	for _, n := range nodes {
+		report.Outcomes[n.ID] = &Outcome{ID: n.ID}
+	}
+	for _, n := range nodes {
+		o := report.Outcomes[n.ID]
+		if len(n.Deps) == 0 {
+			report.Roots = append(report.Roots, o)
+		}
+		for _, d := range dependents[n.ID] {
+			o.Dependents = append(o.Dependents, report.Outcomes[d])
+		}
+	}
+
+	remaining := map[string]int{}
+	var ready []string
+	for _, n := range nodes {
+		remaining[n.ID] = len(n.Deps)
+		if len(n.Deps) == 0 {
+			ready = append(ready, n.ID)
+		}
+	}
+
+	results := make(chan result)
+	running := 0
+
+	for {
+		for len(ready) > 0 && running < parallelism && ctx.Err() == nil {
+			id := ready[0]
+			ready = ready[1:]
+			running++
+			go func(n Node) {
+				results <- runNode(ctx, n)
+			}(byID[id])
+		}
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+
+		o := report.Outcomes[r.id]
+		o.Attempts, o.Start, o.End, o.Err = r.attempts, r.start, r.end, r.err
+
+		switch {
+		case r.err == nil:
+			o.Status = StatusSucceeded
+			for _, d := range dependents[r.id] {
+				remaining[d]--
+				if remaining[d] == 0 && report.Outcomes[d].Status == "" {
+					ready = append(ready, d)
+				}
+			}
+		case ctx.Err() != nil:
+			o.Status = StatusCancelled
+		default:
+			o.Status = StatusFailed
+			skip(report, dependents, r.id)
+		}
+	}
+
+	for _, o := range report.Outcomes {
+		if o.Status == "" {
+			o.Status = StatusCancelled
+		}
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		return report, &Error{Failed: failed}
+	}
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+	return report, nil
+}
+
+func runNode(ctx context.Context, n Node) result {
+	r := result{id: n.ID, start: time.Now()}
+	res, errs := backoff.Retry(ctx, n.Policy, func() (*struct{}, error) {
+		r.attempts++
+		if err := n.Run(ctx); err != nil {
+			return nil, err
+		}
+		return &struct{}{}, nil
+	})
+	r.end = time.Now()
+	if res == nil {
+		r.err = &backoff.RetryError{Errors: errs}
+	}
+	return r
+}
+
+// skip marks every node depending on id, directly or not, as skipped.
+func skip(report *Report, dependents map[string][]string, id string) {
+	for _, d := range dependents[id] {
+		o := report.Outcomes[d]
+		if o.Status != "" {
+			continue
+		}
+		o.Status = StatusSkipped
+		skip(report, dependents, d)
+	}
+}
+
+// build indexes the nodes and checks that the graph is valid.
+func build(nodes []Node) (map[string]Node, map[string][]string, error) {
+	byID := map[string]Node{}
+	for _, n := range nodes {
+		if _, ok := byID[n.ID]; ok {
+			return nil, nil, fmt.Errorf("dag: duplicate node %q", n.ID)
+		}
+		if n.Run == nil {
+			return nil, nil, fmt.Errorf("dag: node %q has no Run", n.ID)
+		}
+		byID[n.ID] = n
+	}
+
+	dependents := map[string][]string{}
+	for _, n := range nodes {
+		for _, d := range n.Deps {
+			if _, ok := byID[d]; !ok {
+				return nil, nil, fmt.Errorf("dag: node %q depends on unknown node %q", n.ID, d)
+			}
+			dependents[d] = append(dependents[d], n.ID)
+		}
+	}
+
+	// Kahn's algorithm: if not every node can be ordered, there is a cycle.
+	remaining := map[string]int{}
+	var queue []string
+	for _, n := range nodes {
+		remaining[n.ID] = len(n.Deps)
+		if len(n.Deps) == 0 {
+			queue = append(queue, n.ID)
+		}
+	}
+	ordered := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		ordered++
+		for _, d := range dependents[id] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+	if ordered != len(nodes) {
+		return nil, nil, ErrCycle
+	}
+
+	return byID, dependents, nil
+}
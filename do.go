@@ -0,0 +1,265 @@
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts Do makes unless told
+	// otherwise.
+	DefaultMaxAttempts = 5
+	// DefaultLimit is the longest delay, in seconds, of the curve Do uses
+	// unless told otherwise.
+	DefaultLimit = 10
+)
+
+// Option configures Do.
+type Option func(*options)
+
+type options struct {
+	curve         func(float64) float64
+	maxAttempts   int
+	infinite      bool
+	hooks         []Hooks
+	overload      OverloadSignal
+	overloadDelay time.Duration
+	retryable     func(error) bool
+	fractional    bool
+	cost          float64
+	costBudget    float64
+}
+
+// Hooks are called as Do makes attempts. Any of them may be nil.
+//
+// Attempts are numbered from 0, matching the value passed to the curve.
+type Hooks struct {
+	// BeforeAttempt is called before each call of the function, after the
+	// delay.
+	BeforeAttempt func(attempt int)
+	// OnFailure is called with the error each time the function fails.
+	OnFailure func(attempt int, err error)
+	// OnSuccess is called when the function returns a value.
+	OnSuccess func(attempt int)
+	// OnShed is called each time an attempt is shed because the process is
+	// overloaded.
+	OnShed func(attempt int)
+}
+
+// WithCurve sets the curve used to determine how long in seconds to wait
+// before each attempt. Defaults to Default(DefaultMaxAttempts, DefaultLimit).
+func WithCurve(curve func(float64) float64) Option {
+	return func(o *options) {
+		o.curve = curve
+	}
+}
+
+// WithFractionalDelays keeps fractions of a second returned by the curve,
+// which are otherwise truncated to whole seconds.
+func WithFractionalDelays() Option {
+	return func(o *options) {
+		o.fractional = true
+	}
+}
+
+// WithMaxAttempts sets the maximum number of attempts to make before giving
+// up. Values below 1 are treated as 1; use WithInfinite to retry
+// indefinitely. Defaults to DefaultMaxAttempts.
+func WithMaxAttempts(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			n = 1
+		}
+		o.maxAttempts = n
+		o.infinite = false
+	}
+}
+
+// WithInfinite retries until the function succeeds or the context is done.
+// Errors are passed to hooks but not returned, as they would accumulate
+// without bound.
+func WithInfinite() Option {
+	return func(o *options) {
+		o.infinite = true
+	}
+}
+
+// WithHooks adds hooks to be called as attempts are made. Hooks from several
+// WithHooks options are all called, in the order given.
+func WithHooks(h Hooks) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks, h)
+	}
+}
+
+// WithOverload checks signal before each retry and sheds the retry while the
+// process is overloaded, after waiting up to `delay` for the overload to
+// clear. Shed retries count as attempts and are returned as ErrShed, and if
+// the last attempt is shed the RetryError's reason is StopShed.
+func WithOverload(signal OverloadSignal, delay time.Duration) Option {
+	return func(o *options) {
+		o.overload = signal
+		o.overloadDelay = delay
+	}
+}
+
+// WithRetryable calls retryable with each error returned by the function, and
+// stops retrying as soon as it returns false. By default every error is
+// retried.
+func WithRetryable(retryable func(error) bool) Option {
+	return func(o *options) {
+		o.retryable = retryable
+	}
+}
+
+// Do will retry fn until it returns a non-nil value, the maximum number of
+// attempts is reached or ctx is done.
+//
+// If it gives up, Do returns a *RetryError holding the error from each
+// attempt, followed by ctx's error if ctx is done, and the reason it stopped.
+//
+// Any Override attached to ctx with OverrideContext is applied on top of the
+// options.
+func Do[T any](ctx context.Context, fn func(context.Context) (*T, error), opts ...Option) (*T, error) {
+	o := options{
+		curve:       Default(DefaultMaxAttempts, DefaultLimit),
+		maxAttempts: DefaultMaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.curve == nil || fn == nil {
+		return nil, ErrInvalidConfig
+	}
+
+	if override, ok := OverrideFromContext(ctx); ok {
+		override.apply(&o)
+	}
+
+	errs := []error{}
+	stop := func(reason StopReason) error {
+		return &RetryError{Errors: errs, Reason: reason}
+	}
+
+	var spent float64
+	shed := false
+	meter := &costMeter{}
+	ctx = context.WithValue(ctx, costKey{}, meter)
+
+	for attempt := 0; o.infinite || attempt < o.maxAttempts; attempt++ {
+		if o.overBudget(spent) {
+			errs = append(errs, ErrBudgetExhausted)
+			return nil, stop(StopBudget)
+		}
+
+		if !wait(ctx, o.delay(attempt)) {
+			errs = append(errs, ctx.Err())
+			return nil, stop(StopContext)
+		}
+
+		shed = false
+		if attempt > 0 && o.overload != nil {
+			shed = o.overload.Overloaded()
+			if shed && o.overloadDelay > 0 {
+				if !wait(ctx, o.overloadDelay) {
+					errs = append(errs, ctx.Err())
+					return nil, stop(StopContext)
+				}
+				shed = o.overload.Overloaded()
+			}
+			if shed {
+				o.onShed(attempt)
+				if !o.infinite {
+					errs = append(errs, ErrShed)
+				}
+				continue
+			}
+		}
+
+		o.beforeAttempt(attempt)
+		meter.reset()
+		res, err := fn(ctx)
+		// A nil *T would make a non-nil interface, so it is passed as nil.
+		if res != nil {
+			spent += o.attemptCost(meter, res, err)
+		} else {
+			spent += o.attemptCost(meter, nil, err)
+		}
+
+		if err != nil {
+			o.onFailure(attempt, err)
+			if !o.infinite {
+				errs = append(errs, err)
+			}
+		}
+		if res != nil {
+			o.onSuccess(attempt)
+			return res, nil
+		}
+		if err != nil && o.retryable != nil && !o.retryable(err) {
+			if o.infinite {
+				// The error which ended retrying is always returned.
+				errs = append(errs, err)
+			}
+			return nil, stop(StopNotRetryable)
+		}
+	}
+
+	if shed {
+		return nil, stop(StopShed)
+	}
+	return nil, stop(StopMaxAttempts)
+}
+
+func (o *options) delay(attempt int) time.Duration {
+	if o.fractional {
+		return FractionalDelay(o.curve, attempt)
+	}
+	return Delay(o.curve, attempt)
+}
+
+func (o *options) beforeAttempt(attempt int) {
+	for _, h := range o.hooks {
+		if h.BeforeAttempt != nil {
+			h.BeforeAttempt(attempt)
+		}
+	}
+}
+
+func (o *options) onFailure(attempt int, err error) {
+	for _, h := range o.hooks {
+		if h.OnFailure != nil {
+			h.OnFailure(attempt, err)
+		}
+	}
+}
+
+func (o *options) onSuccess(attempt int) {
+	for _, h := range o.hooks {
+		if h.OnSuccess != nil {
+			h.OnSuccess(attempt)
+		}
+	}
+}
+
+func (o *options) onShed(attempt int) {
+	for _, h := range o.hooks {
+		if h.OnShed != nil {
+			h.OnShed(attempt)
+		}
+	}
+}
+
+// wait blocks for d, returning false if ctx is done first.
+func wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
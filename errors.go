@@ -1,7 +1,52 @@
 package backoff
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrInvalidConfig = errors.New("invalid config: curve and func are required")
+	ErrInvalidConfig   = errors.New("invalid config: curve and func are required")
+	ErrShed            = errors.New("retry shed: process overloaded")
+	ErrBudgetExhausted = errors.New("retry stopped: cost budget exhausted")
+)
+
+// StopReason is why an operation gave up.
+type StopReason string
+
+const (
+	// StopMaxAttempts means the maximum number of attempts was reached.
+	StopMaxAttempts StopReason = "max-attempts"
+	// StopContext means the context was done.
+	StopContext StopReason = "context"
+	// StopNotRetryable means an error was not retryable.
+	StopNotRetryable StopReason = "not-retryable"
+	// StopBudget means another attempt would exceed the cost budget.
+	StopBudget StopReason = "budget"
+	// StopShed means the attempts ran out while retries were being shed
+	// because the process was overloaded.
+	StopShed StopReason = "shed"
 )
+
+// RetryError is returned when an operation gives up, and holds the error from
+// each of its attempts.
+type RetryError struct {
+	Errors []error
+	// Reason is why the operation gave up. It is empty for RetryErrors not
+	// made by Do.
+	Reason StopReason
+}
+
+// Error returns the last error along with the number of attempts.
+func (e *RetryError) Error() string {
+	if len(e.Errors) == 0 {
+		return "gave up retrying"
+	}
+	return fmt.Sprintf("gave up after %d errors: %v", len(e.Errors), e.Errors[len(e.Errors)-1])
+}
+
+// Unwrap returns the errors from each attempt, so that errors.Is and
+// errors.As match any of them.
+func (e *RetryError) Unwrap() []error {
+	return e.Errors
+}
@@ -0,0 +1,201 @@
+// Package filelock acquires advisory file locks, retrying with backoff while
+// another process holds the lock.
+//
+// The lock file records the PID of its holder and when the lock was taken, so
+// that locks left behind by dead or hung processes can be detected and broken.
+package filelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+var (
+	// ErrLocked is returned by an attempt when another process holds the lock.
+	ErrLocked = errors.New("filelock: locked by another process")
+	// ErrUnsupported is returned on platforms without advisory file locks.
+	ErrUnsupported = errors.New("filelock: not supported on this platform")
+
+	errReplaced = errors.New("filelock: lock file replaced while locking")
+)
+
+// Options configures how a lock is acquired.
+type Options struct {
+	// Policy is used to retry while the lock is held by another process. If
+	// Policy.MaxAttempts is 0, Acquire waits until the lock is free or ctx is
+	// done.
+	Policy backoff.Policy
+	// StaleAfter is how long a lock may be held before it is considered stale
+	// and broken. If 0, locks are only broken when their holder is no longer
+	// running.
+	//
+	// Breaking a lock by age is only safe if holders never run for longer
+	// than StaleAfter: a holder which is still running when its lock is
+	// broken carries on as if it held the lock, alongside the new holder.
+	StaleAfter time.Duration
+}
+
+// Lock is a held file lock.
+type Lock struct {
+	file *os.File
+	path string
+}
+
+// Acquire locks the file at `path`, creating it if needed, and retries under
+// the options' policy while another process holds it.
+//
+// Only contention is retried. Other errors, such as the lock file's directory
+// not existing or ErrUnsupported, are returned as they are straight away.
+func Acquire(ctx context.Context, path string, opts Options) (*Lock, error) {
+	policy := opts.Policy
+	retryable := policy.Retryable
+	policy.Retryable = func(err error) bool {
+		return contended(err) && (retryable == nil || retryable(err))
+	}
+
+	lock, errs := backoff.Retry(ctx, policy, func() (*Lock, error) {
+		return tryLock(path, opts.StaleAfter)
+	})
+	if lock != nil {
+		return lock, nil
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("filelock: acquire %s: %w", path, ErrLocked)
+	}
+	last := errs[len(errs)-1]
+	if !contended(last) && ctx.Err() == nil {
+		return nil, last
+	}
+	return nil, fmt.Errorf("filelock: acquire %s: %w", path, last)
+}
+
+// contended reports whether err means another process got to the lock first.
+func contended(err error) bool {
+	return errors.Is(err, ErrLocked) || errors.Is(err, errReplaced)
+}
+
+// Release removes the lock file and unlocks it. If the lock was broken as
+// stale, the file at the path belongs to the new holder and is left alone.
+func (l *Lock) Release() error {
+	// The file is removed while still locked, so that a process which opened
+	// it in the meantime notices the replacement instead of locking a file
+	// nobody else can see.
+	var removeErr error
+	if samePath(l.file, l.path) {
+		removeErr = os.Remove(l.path)
+	}
+	unlockErr := unlock(l.file)
+	closeErr := l.file.Close()
+
+	if removeErr != nil && !os.IsNotExist(removeErr) {
+		return removeErr
+	}
+	if unlockErr != nil {
+		return unlockErr
+	}
+	return closeErr
+}
+
+// Path returns the path of the lock file.
+func (l *Lock) Path() string {
+	return l.path
+}
+
+func tryLock(path string, staleAfter time.Duration) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lock(f); err != nil {
+		if errors.Is(err, ErrLocked) {
+			breakIfStale(f, path, staleAfter)
+		}
+		f.Close()
+		return nil, err
+	}
+
+	// Another process may have released or broken the lock and removed the
+	// file between our open and lock, in which case we hold a lock on a file
+	// which is no longer at path.
+	if !samePath(f, path) {
+		unlock(f)
+		f.Close()
+		return nil, errReplaced
+	}
+
+	if err := writeOwner(f); err != nil {
+		unlock(f)
+		f.Close()
+		return nil, err
+	}
+
+	return &Lock{file: f, path: path}, nil
+}
+
+// breakIfStale removes the lock file if its holder is no longer running or
+// has held it for longer than staleAfter. Processes waiting for the lock will
+// then create a fresh file at path, while the stale holder keeps its lock on
+// the removed one.
+func breakIfStale(f *os.File, path string, staleAfter time.Duration) {
+	pid, since, ok := readOwner(f)
+	if !ok {
+		return
+	}
+
+	stale := !processAlive(pid) || (staleAfter > 0 && time.Since(since) > staleAfter)
+	if stale && samePath(f, path) {
+		os.Remove(path)
+	}
+}
+
+// writeOwner records the current process and time in the lock file, as
+// "<pid> <unix nanoseconds>".
+func writeOwner(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	owner := fmt.Sprintf("%d %d\n", os.Getpid(), time.Now().UnixNano())
+	_, err := f.WriteAt([]byte(owner), 0)
+	return err
+}
+
+func readOwner(f *os.File) (pid int, since time.Time, ok bool) {
+	buf := make([]byte, 64)
+	n, _ := f.ReadAt(buf, 0)
+
+	fields := strings.Fields(string(buf[:n]))
+	if len(fields) != 2 {
+		return 0, time.Time{}, false
+	}
+
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	return pid, time.Unix(0, nanos), true
+}
+
+func samePath(f *os.File, path string) bool {
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fileInfo, pathInfo)
+}
@@ -0,0 +1,214 @@
+//go:build unix
+
+package filelock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// helperEnv holds the lock path when the test binary is re-executed as a lock
+// holder.
+const helperEnv = "FILELOCK_TEST_HOLDER"
+
+func TestMain(m *testing.M) {
+	if path := os.Getenv(helperEnv); path != "" {
+		os.Exit(holdLock(path))
+	}
+	os.Exit(m.Run())
+}
+
+// holdLock acquires the lock at path, reports it on stdout, and holds it until
+// stdin is closed.
+func holdLock(path string) int {
+	lock, err := Acquire(context.Background(), path, Options{Policy: backoff.Policy{
+		Curve:            func(float64) float64 { return 0.01 },
+		MaxAttempts:      100,
+		FractionalDelays: true,
+	}})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("locked")
+
+	io.Copy(io.Discard, os.Stdin)
+
+	if err := lock.Release(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+type holder struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// startHolder runs a process holding the lock at path, returning once it has
+// the lock.
+func startHolder(t *testing.T, path string) *holder {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), helperEnv+"="+path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &holder{cmd: cmd, stdin: stdin}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "locked\n" {
+		t.Fatalf("holder did not lock: %q, %v", line, err)
+	}
+	return h
+}
+
+// release makes the holder release its lock and waits for it to exit.
+func (h *holder) release(t *testing.T) {
+	t.Helper()
+	h.stdin.Close()
+	if err := h.cmd.Wait(); err != nil {
+		t.Fatalf("holder failed: %v", err)
+	}
+}
+
+func fastPolicy(attempts int) backoff.Policy {
+	return backoff.Policy{
+		Curve:            func(float64) float64 { return 0.02 },
+		MaxAttempts:      attempts,
+		FractionalDelays: true,
+	}
+}
+
+func TestContention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	h := startHolder(t, path)
+
+	_, err := Acquire(context.Background(), path, Options{Policy: fastPolicy(3)})
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Acquire while held = %v, want ErrLocked", err)
+	}
+
+	h.release(t)
+
+	lock, err := Acquire(context.Background(), path, Options{Policy: fastPolicy(3)})
+	if err != nil {
+		t.Fatalf("Acquire after release = %v", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists after Release: %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	startHolder(t, path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := Acquire(ctx, path, Options{Policy: fastPolicy(0)})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Acquire took %s to notice ctx was done", elapsed)
+	}
+}
+
+func TestKilledHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	h := startHolder(t, path)
+
+	h.cmd.Process.Kill()
+	h.cmd.Wait()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("lock file missing after holder was killed: %v", err)
+	}
+
+	lock, err := Acquire(context.Background(), path, Options{Policy: fastPolicy(3)})
+	if err != nil {
+		t.Fatalf("Acquire after holder was killed = %v", err)
+	}
+	defer lock.Release()
+
+	pid, _, ok := readOwner(lock.file)
+	if !ok || pid != os.Getpid() {
+		t.Errorf("lock file owner = %d, %v, want %d", pid, ok, os.Getpid())
+	}
+}
+
+func TestStaleAfter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	h := startHolder(t, path)
+
+	lock, err := Acquire(context.Background(), path, Options{
+		Policy:     fastPolicy(100),
+		StaleAfter: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Acquire with StaleAfter = %v", err)
+	}
+	defer lock.Release()
+
+	// The old holder releasing must not remove the new holder's file.
+	h.release(t)
+	if !samePath(lock.file, path) {
+		t.Fatal("old holder's Release removed the new lock file")
+	}
+
+	_, err = Acquire(context.Background(), path, Options{Policy: fastPolicy(2)})
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Acquire while newly held = %v, want ErrLocked", err)
+	}
+}
+
+func TestPermanentError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "lock")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	calls := 0
+	_, err := Acquire(ctx, path, Options{Policy: backoff.Policy{
+		Curve:            func(float64) float64 { return 0.01 },
+		LogFailure:       func(error) { calls++ },
+		FractionalDelays: true,
+	}})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Acquire = %v, want os.ErrNotExist", err)
+	}
+	if calls != 1 {
+		t.Errorf("made %d attempts, want 1", calls)
+	}
+}
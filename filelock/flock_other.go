@@ -0,0 +1,17 @@
+//go:build !unix
+
+package filelock
+
+import "os"
+
+func lock(f *os.File) error {
+	return ErrUnsupported
+}
+
+func unlock(f *os.File) error {
+	return ErrUnsupported
+}
+
+func processAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,87 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Group runs tasks in goroutines, retrying each under its own policy, in the
+// style of errgroup.Group.
+//
+// The first task to give up cancels the group's context, stopping the others.
+// The zero value is a Group whose tasks run with context.Background; use
+// NewGroup to derive the context from another and to get hold of it.
+type Group struct {
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	errs   []error
+	failed bool
+}
+
+// NewGroup returns a Group and the context its tasks run with, which is
+// cancelled when a task gives up or Wait returns.
+func NewGroup(ctx context.Context) (*Group, context.Context) {
+	g := &Group{}
+	g.init(ctx)
+	return g, g.ctx
+}
+
+// init sets up the group's context from parent, unless it already has one.
+func (g *Group) init(parent context.Context) {
+	g.once.Do(func() {
+		g.ctx, g.cancel = context.WithCancel(parent)
+	})
+}
+
+// Go runs task in a new goroutine, retrying it under p until it returns nil.
+func (g *Group) Go(task func(ctx context.Context) error, p Policy) {
+	g.init(context.Background())
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+
+		_, err := Do(g.ctx, func(ctx context.Context) (*struct{}, error) {
+			if err := task(ctx); err != nil {
+				return nil, err
+			}
+			return &struct{}{}, nil
+		}, p.options()...)
+		if err == nil {
+			return
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		// Tasks stopped because another task gave up are not failures of
+		// their own.
+		if g.failed && errors.Is(err, context.Canceled) {
+			return
+		}
+
+		g.errs = append(g.errs, err)
+		if !g.failed {
+			g.failed = true
+			g.cancel()
+		}
+	}()
+}
+
+// Wait blocks until every task has returned, and returns the RetryError of
+// each task that gave up, joined with errors.Join, or nil if all succeeded.
+func (g *Group) Wait() error {
+	g.init(context.Background())
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return errors.Join(g.errs...)
+}
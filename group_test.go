@@ -0,0 +1,88 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupZeroValue(t *testing.T) {
+	var g Group
+	if err := g.Wait(); err != nil {
+		t.Fatalf("Wait with no tasks = %v", err)
+	}
+
+	var g2 Group
+	calls := 0
+	g2.Go(func(ctx context.Context) error {
+		if ctx == nil {
+			t.Error("task got a nil context")
+		}
+		calls++
+		if calls < 2 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, Policy{Curve: zero, MaxAttempts: 3})
+	if err := g2.Wait(); err != nil {
+		t.Fatalf("Wait = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("task called %d times, want 2", calls)
+	}
+}
+
+func TestGroupFirstFailureCancels(t *testing.T) {
+	g, ctx := NewGroup(context.Background())
+	boom := errors.New("boom")
+
+	var stopped atomic.Bool
+	started := make(chan struct{})
+	g.Go(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		stopped.Store(true)
+		return ctx.Err()
+	}, Policy{Curve: zero, MaxAttempts: 1})
+	<-started
+
+	g.Go(func(context.Context) error {
+		return boom
+	}, Policy{Curve: zero, MaxAttempts: 2})
+
+	err := g.Wait()
+	if !stopped.Load() {
+		t.Error("other task was not cancelled")
+	}
+	if ctx.Err() == nil {
+		t.Error("group context not cancelled")
+	}
+
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("Wait = %v, want a RetryError", err)
+	}
+	if retryErr.Reason != StopMaxAttempts || len(retryErr.Errors) != 2 || !errors.Is(err, boom) {
+		t.Errorf("Wait = %v with reason %v, want 2 boom errors and StopMaxAttempts", err, retryErr.Reason)
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("Wait = %v, want the cancelled task left out", err)
+	}
+}
+
+func TestGroupParentContext(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	g, _ := NewGroup(parent)
+	g.Go(func(ctx context.Context) error {
+		return errors.New("down")
+	}, Policy{Curve: func(float64) float64 { return 0.01 }, FractionalDelays: true})
+
+	var retryErr *RetryError
+	if err := g.Wait(); !errors.As(err, &retryErr) || retryErr.Reason != StopContext {
+		t.Fatalf("Wait = %v, want a RetryError with StopContext", err)
+	}
+}
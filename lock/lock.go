@@ -0,0 +1,215 @@
+// Package lock acquires and renews leases on distributed locks, retrying with
+// backoff.
+//
+// Backends such as etcd, Redis or Postgres implement Locker, and Mutex drives
+// the acquire and renew loops on top of them. Memory is a reference Locker
+// for tests.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+var (
+	// ErrHeld is returned by Locker.TryAcquire when another owner holds an
+	// unexpired lease on the key.
+	ErrHeld = errors.New("lock: held by another owner")
+	// ErrNotHeld is returned by Locker.Renew and Locker.Release when the owner
+	// no longer holds the lease, eg. because it expired and was taken by
+	// someone else.
+	ErrNotHeld = errors.New("lock: lease not held")
+)
+
+// Locker is a backend which grants time-limited leases on keys.
+type Locker interface {
+	// TryAcquire takes the lease on key for owner, lasting ttl, if nobody else
+	// holds it. It returns ErrHeld if another owner does.
+	TryAcquire(ctx context.Context, key, owner string, ttl time.Duration) error
+	// Renew extends owner's lease on key to last ttl from now. It returns
+	// ErrNotHeld if owner does not hold the lease.
+	Renew(ctx context.Context, key, owner string, ttl time.Duration) error
+	// Release gives up owner's lease on key. It returns ErrNotHeld if owner
+	// does not hold the lease.
+	Release(ctx context.Context, key, owner string) error
+}
+
+// DefaultPolicy is used when a Mutex's policies have no curve. It retries
+// indefinitely, making the first attempt immediately and waiting up to one
+// more second before each following attempt, with jitter. Renewals happen
+// well within a TTL, so it waits fractions of a second.
+var DefaultPolicy = backoff.Policy{
+	Curve: backoff.Jitter(func(x float64) float64 {
+		return backoff.Linear(x, 1)
+	}, 0.5),
+	FractionalDelays: true,
+}
+
+// Mutex acquires the lease on a single key.
+type Mutex struct {
+	// Locker is the backend holding the lease.
+	Locker Locker
+	// Key is the name of the lock.
+	Key string
+	// Owner identifies this holder to the backend. If empty, a random owner
+	// is generated on each Acquire.
+	Owner string
+	// TTL is how long the lease lasts without renewal. The lease is renewed
+	// after a third of the TTL has passed.
+	TTL time.Duration
+	// Policy is used to retry while the lease is held by someone else.
+	Policy backoff.Policy
+	// RenewPolicy is used to retry failed renewals. Renewal is retried until
+	// the lease would have expired, even if its MaxAttempts is 0.
+	RenewPolicy backoff.Policy
+}
+
+// Acquire takes the lease, retrying under the mutex's policy while it is held
+// by someone else, and keeps renewing it until it is released or lost.
+func (m *Mutex) Acquire(ctx context.Context) (*Lease, error) {
+	if m.Locker == nil || m.TTL <= 0 {
+		return nil, backoff.ErrInvalidConfig
+	}
+
+	owner := m.Owner
+	if owner == "" {
+		owner = randomOwner()
+	}
+
+	lease, errs := backoff.Retry(ctx, policyOrDefault(m.Policy), func() (*Lease, error) {
+		// The backend's TTL may start any time during the call, so the lease
+		// is assumed to expire a TTL after it began.
+		start := time.Now()
+		if err := m.Locker.TryAcquire(ctx, m.Key, owner, m.TTL); err != nil {
+			return nil, err
+		}
+		return &Lease{
+			mutex:   m,
+			owner:   owner,
+			expires: start.Add(m.TTL),
+		}, nil
+	})
+	if lease == nil {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("lock: acquire %s: %w", m.Key, ErrHeld)
+		}
+		return nil, fmt.Errorf("lock: acquire %s: %w", m.Key, errs[len(errs)-1])
+	}
+
+	renewCtx, cancel := context.WithCancel(context.Background())
+	lease.cancel = cancel
+	lease.lost = make(chan struct{})
+	lease.done = make(chan struct{})
+	go lease.renew(renewCtx)
+
+	return lease, nil
+}
+
+// Lease is a held lock, which is renewed in the background until released.
+type Lease struct {
+	mutex   *Mutex
+	owner   string
+	cancel  context.CancelFunc
+	lost    chan struct{}
+	done    chan struct{}
+	expires time.Time
+
+	mu       sync.Mutex
+	released bool
+}
+
+// Owner returns the owner the lease was taken as.
+func (l *Lease) Owner() string {
+	return l.owner
+}
+
+// Lost returns a channel which is closed if the lease could not be renewed
+// before it expired. Work protected by the lock should stop when it is.
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release stops renewing the lease and gives it up.
+func (l *Lease) Release(ctx context.Context) error {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return nil
+	}
+	l.released = true
+	l.mu.Unlock()
+
+	l.cancel()
+	<-l.done
+
+	select {
+	case <-l.lost:
+		return ErrNotHeld
+	default:
+	}
+	return l.mutex.Locker.Release(ctx, l.mutex.Key, l.owner)
+}
+
+func (l *Lease) renew(ctx context.Context) {
+	defer close(l.done)
+
+	m := l.mutex
+	interval := m.TTL / 3
+
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// Renewal is only worth retrying while the lease is still ours.
+		attemptCtx, cancel := context.WithDeadline(ctx, l.expires)
+		renewed, _ := backoff.Retry(attemptCtx, policyOrDefault(m.RenewPolicy), func() (*time.Time, error) {
+			start := time.Now()
+			err := m.Locker.Renew(attemptCtx, m.Key, l.owner, m.TTL)
+			if errors.Is(err, ErrNotHeld) {
+				cancel()
+			}
+			if err != nil {
+				return nil, err
+			}
+			expires := start.Add(m.TTL)
+			return &expires, nil
+		})
+		cancel()
+
+		if renewed == nil {
+			if ctx.Err() == nil {
+				close(l.lost)
+			}
+			return
+		}
+		l.expires = *renewed
+	}
+}
+
+func policyOrDefault(p backoff.Policy) backoff.Policy {
+	if p.Curve == nil {
+		p.Curve = DefaultPolicy.Curve
+		p.FractionalDelays = DefaultPolicy.FractionalDelays
+	}
+	return p
+}
+
+func randomOwner() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("owner-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,158 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+func fastPolicy(attempts int) backoff.Policy {
+	return backoff.Policy{
+		Curve:            func(float64) float64 { return 0.01 },
+		MaxAttempts:      attempts,
+		FractionalDelays: true,
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	locker := NewMemory()
+	a := &Mutex{Locker: locker, Key: "k", Owner: "a", TTL: time.Second, Policy: fastPolicy(3)}
+	b := &Mutex{Locker: locker, Key: "k", Owner: "b", TTL: time.Second, Policy: fastPolicy(3)}
+
+	lease, err := a.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire = %v", err)
+	}
+	if lease.Owner() != "a" {
+		t.Errorf("Owner() = %q, want a", lease.Owner())
+	}
+
+	if _, err := b.Acquire(context.Background()); !errors.Is(err, ErrHeld) {
+		t.Fatalf("Acquire while held = %v, want ErrHeld", err)
+	}
+
+	if err := lease.Release(context.Background()); err != nil {
+		t.Fatalf("Release = %v", err)
+	}
+	if err := lease.Release(context.Background()); err != nil {
+		t.Errorf("second Release = %v, want nil", err)
+	}
+
+	other, err := b.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire after release = %v", err)
+	}
+	other.Release(context.Background())
+}
+
+func TestAcquireCancel(t *testing.T) {
+	locker := NewMemory()
+	a := &Mutex{Locker: locker, Key: "k", Owner: "a", TTL: time.Second}
+	b := &Mutex{Locker: locker, Key: "k", Owner: "b", TTL: time.Second}
+
+	lease, err := a.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Release(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := b.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	locker := NewMemory()
+	ttl := 150 * time.Millisecond
+	a := &Mutex{Locker: locker, Key: "k", Owner: "a", TTL: ttl, RenewPolicy: fastPolicy(0)}
+	b := &Mutex{Locker: locker, Key: "k", Owner: "b", TTL: ttl, Policy: fastPolicy(1)}
+
+	lease, err := a.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Release(context.Background())
+
+	// Well past the TTL, the lease is still held thanks to renewal.
+	time.Sleep(3 * ttl)
+	if _, err := b.Acquire(context.Background()); !errors.Is(err, ErrHeld) {
+		t.Fatalf("Acquire after renewals = %v, want ErrHeld", err)
+	}
+	select {
+	case <-lease.Lost():
+		t.Fatal("lease lost despite renewals")
+	default:
+	}
+}
+
+// failingRenew is a Memory whose renewals fail once fail is set.
+type failingRenew struct {
+	*Memory
+	fail atomic.Bool
+	err  error
+}
+
+func (f *failingRenew) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	if f.fail.Load() {
+		return f.err
+	}
+	return f.Memory.Renew(ctx, key, owner, ttl)
+}
+
+func TestLost(t *testing.T) {
+	for _, renewErr := range []error{ErrNotHeld, errors.New("backend down")} {
+		t.Run(renewErr.Error(), func(t *testing.T) {
+			locker := &failingRenew{Memory: NewMemory(), err: renewErr}
+			ttl := 150 * time.Millisecond
+			a := &Mutex{Locker: locker, Key: "k", Owner: "a", TTL: ttl, RenewPolicy: fastPolicy(0)}
+
+			lease, err := a.Acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			locker.fail.Store(true)
+
+			select {
+			case <-lease.Lost():
+			case <-time.After(5 * ttl):
+				t.Fatal("lease not lost after renewals failed")
+			}
+			if err := lease.Release(context.Background()); !errors.Is(err, ErrNotHeld) {
+				t.Errorf("Release of lost lease = %v, want ErrNotHeld", err)
+			}
+		})
+	}
+}
+
+// slowLocker takes `delay` to answer every call.
+type slowLocker struct {
+	*Memory
+	delay time.Duration
+}
+
+func (s slowLocker) TryAcquire(ctx context.Context, key, owner string, ttl time.Duration) error {
+	time.Sleep(s.delay)
+	return s.Memory.TryAcquire(ctx, key, owner, ttl)
+}
+
+func TestExpiresFromCallStart(t *testing.T) {
+	ttl := time.Second
+	a := &Mutex{Locker: slowLocker{NewMemory(), 100 * time.Millisecond}, Key: "k", TTL: ttl}
+
+	start := time.Now()
+	lease, err := a.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Release(context.Background())
+
+	if lease.expires.Sub(start) >= ttl+50*time.Millisecond {
+		t.Errorf("lease expires %s after the call started, want at most the TTL %s", lease.expires.Sub(start), ttl)
+	}
+}
@@ -0,0 +1,63 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process Locker, intended as a reference backend for tests.
+type Memory struct {
+	mu     sync.Mutex
+	leases map[string]memoryLease
+}
+
+type memoryLease struct {
+	owner   string
+	expires time.Time
+}
+
+// NewMemory returns an empty Memory locker.
+func NewMemory() *Memory {
+	return &Memory{leases: map[string]memoryLease{}}
+}
+
+// TryAcquire implements Locker.
+func (m *Memory) TryAcquire(ctx context.Context, key, owner string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if lease, ok := m.leases[key]; ok && lease.owner != owner && now.Before(lease.expires) {
+		return ErrHeld
+	}
+	m.leases[key] = memoryLease{owner: owner, expires: now.Add(ttl)}
+	return nil
+}
+
+// Renew implements Locker.
+func (m *Memory) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	lease, ok := m.leases[key]
+	if !ok || lease.owner != owner || !now.Before(lease.expires) {
+		return ErrNotHeld
+	}
+	m.leases[key] = memoryLease{owner: owner, expires: now.Add(ttl)}
+	return nil
+}
+
+// Release implements Locker.
+func (m *Memory) Release(ctx context.Context, key, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lease, ok := m.leases[key]
+	if !ok || lease.owner != owner || !time.Now().Before(lease.expires) {
+		return ErrNotHeld
+	}
+	delete(m.leases, key)
+	return nil
+}
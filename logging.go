@@ -0,0 +1,192 @@
+package backoff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SuppressedError is passed to the wrapped log function by SampledLog to
+// summarise failures which were not logged.
+type SuppressedError struct {
+	Operation string
+	Class     string
+	// Count is how many failures were suppressed.
+	Count int
+	// Last is the last suppressed failure.
+	Last error
+}
+
+func (e *SuppressedError) Error() string {
+	return fmt.Sprintf("%s: suppressed %d similar errors: %v", e.Operation, e.Count, e.Last)
+}
+
+func (e *SuppressedError) Unwrap() error {
+	return e.Last
+}
+
+// SampledLog rate-limits failure logging, so that an outage produces a few
+// lines per interval rather than one for every failed attempt.
+//
+// Failures are grouped by operation and error class. Within each Interval,
+// the first Burst failures of a group are logged and the rest are counted,
+// then summarised as a single SuppressedError when the interval ends.
+type SampledLog struct {
+	// Log receives the failures which are logged, and the summaries. It is
+	// required; a SampledLog without it logs nothing.
+	Log func(error)
+	// Interval is the length of each rate-limiting window. Defaults to 1
+	// minute.
+	Interval time.Duration
+	// Burst is how many failures of each group are logged per interval.
+	// Defaults to 1.
+	Burst int
+	// Class returns the class of an error for grouping. Defaults to
+	// ErrorClass, as messages often hold details such as addresses and
+	// ports which would put every failure in a group of its own.
+	Class func(error) string
+
+	mu      sync.Mutex
+	windows map[sampleKey]*sampleWindow
+}
+
+type sampleKey struct {
+	operation string
+	class     string
+}
+
+type sampleWindow struct {
+	logged     int
+	suppressed int
+	last       error
+}
+
+// LogFailure returns a function, suitable for Config.LogFailure, which logs
+// failures of `operation` through s.
+func (s *SampledLog) LogFailure(operation string) func(error) {
+	return func(err error) {
+		s.log(operation, err)
+	}
+}
+
+// Hooks returns hooks, suitable for WithHooks, which log failures of
+// `operation` through s.
+func (s *SampledLog) Hooks(operation string) Hooks {
+	return Hooks{
+		OnFailure: func(_ int, err error) {
+			s.log(operation, err)
+		},
+	}
+}
+
+// Flush emits the summaries of every open window straight away, eg. before
+// the program exits.
+func (s *SampledLog) Flush() {
+	s.mu.Lock()
+	windows := make(map[sampleKey]*sampleWindow, len(s.windows))
+	for key, w := range s.windows {
+		windows[key] = w
+	}
+	s.mu.Unlock()
+
+	for key, w := range windows {
+		s.close(key, w)
+	}
+}
+
+func (s *SampledLog) log(operation string, err error) {
+	if s.Log == nil {
+		return
+	}
+
+	class := ErrorClass(err)
+	if s.Class != nil {
+		class = s.Class(err)
+	}
+	key := sampleKey{operation: operation, class: class}
+
+	burst := s.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	s.mu.Lock()
+	if s.windows == nil {
+		s.windows = map[sampleKey]*sampleWindow{}
+	}
+	w, ok := s.windows[key]
+	if !ok {
+		w = &sampleWindow{}
+		s.windows[key] = w
+		// The window closes on a timer, so the summary is emitted even if
+		// the failures stop.
+		time.AfterFunc(s.interval(), func() {
+			s.close(key, w)
+		})
+	}
+
+	if w.logged < burst {
+		w.logged++
+		s.mu.Unlock()
+		s.Log(err)
+		return
+	}
+
+	w.suppressed++
+	w.last = err
+	s.mu.Unlock()
+}
+
+// close ends window w for key, emitting its summary if anything was
+// suppressed. It does nothing if w has already been closed by Flush.
+func (s *SampledLog) close(key sampleKey, w *sampleWindow) {
+	s.mu.Lock()
+	if s.windows[key] != w {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.windows, key)
+	s.mu.Unlock()
+
+	if w.suppressed > 0 {
+		s.Log(&SuppressedError{
+			Operation: key.operation,
+			Class:     key.class,
+			Count:     w.suppressed,
+			Last:      w.last,
+		})
+	}
+}
+
+// ErrorClass describes err by the types of the errors in its chain and, if err
+// wraps other errors, the message of the innermost one. Wrapped errors are
+// usually sentinels, such as syscall errors, whose messages do not vary, eg.
+// a reset connection is classed as
+// "*net.OpError > *os.SyscallError > syscall.Errno: connection reset by peer".
+func ErrorClass(err error) string {
+	var b strings.Builder
+	wrapped := false
+	for {
+		fmt.Fprintf(&b, "%T", err)
+		next := errors.Unwrap(err)
+		if next == nil {
+			break
+		}
+		b.WriteString(" > ")
+		err = next
+		wrapped = true
+	}
+	if wrapped {
+		fmt.Fprintf(&b, ": %v", err)
+	}
+	return b.String()
+}
+
+func (s *SampledLog) interval() time.Duration {
+	if s.Interval <= 0 {
+		return time.Minute
+	}
+	return s.Interval
+}
@@ -0,0 +1,122 @@
+package backoff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// logRecorder collects the errors logged through it, from any goroutine.
+type logRecorder struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (r *logRecorder) log(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+func (r *logRecorder) logged() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.errs...)
+}
+
+func resetError(addr string) error {
+	return &net.OpError{
+		Op:   "read",
+		Net:  "tcp",
+		Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 443},
+		Err:  os.NewSyscallError("read", syscall.ECONNRESET),
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("boom"), "*errors.errorString"},
+		{fmt.Errorf("reading: %w", io.EOF), "*fmt.wrapError > *errors.errorString: EOF"},
+		{resetError("10.0.0.1"), "*net.OpError > *os.SyscallError > syscall.Errno: connection reset by peer"},
+	}
+	for _, tt := range tests {
+		if got := ErrorClass(tt.err); got != tt.want {
+			t.Errorf("ErrorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+
+	if ErrorClass(resetError("10.0.0.1")) != ErrorClass(resetError("10.0.0.2")) {
+		t.Error("resets from different addresses classed apart")
+	}
+}
+
+func TestSampledLog(t *testing.T) {
+	rec := &logRecorder{}
+	s := &SampledLog{Log: rec.log, Interval: 100 * time.Millisecond, Burst: 2}
+
+	log := s.LogFailure("fetch")
+	for i := 0; i < 5; i++ {
+		log(resetError(fmt.Sprintf("10.0.0.%d", i)))
+	}
+	s.LogFailure("store")(resetError("10.0.0.9"))
+	log(errors.New("other class"))
+
+	if n := len(rec.logged()); n != 4 {
+		t.Fatalf("logged %d errors straight away, want 2 resets, the other operation and the other class", n)
+	}
+
+	// The window ends on its own, summarising the suppressed failures.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.logged()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	logged := rec.logged()
+	if len(logged) != 5 {
+		t.Fatalf("logged %v, want a summary after the interval", logged)
+	}
+	var summary *SuppressedError
+	if !errors.As(logged[4], &summary) {
+		t.Fatalf("last logged %v, want a SuppressedError", logged[4])
+	}
+	if summary.Operation != "fetch" || summary.Count != 3 || summary.Last.Error() != resetError("10.0.0.4").Error() {
+		t.Errorf("summary = %v", summary)
+	}
+
+	// A new window logs again.
+	log(resetError("10.0.0.1"))
+	if n := len(rec.logged()); n != 6 {
+		t.Errorf("logged %d errors after the window ended, want 6", n)
+	}
+}
+
+func TestSampledLogFlush(t *testing.T) {
+	rec := &logRecorder{}
+	s := &SampledLog{Log: rec.log, Interval: 50 * time.Millisecond}
+
+	hooks := s.Hooks("fetch")
+	for i := 0; i < 3; i++ {
+		hooks.OnFailure(i, errors.New("down"))
+	}
+	s.Flush()
+
+	logged := rec.logged()
+	var summary *SuppressedError
+	if len(logged) != 2 || !errors.As(logged[1], &summary) || summary.Count != 2 {
+		t.Fatalf("logged %v after Flush, want the first failure and a summary of 2", logged)
+	}
+
+	// The window's timer must not summarise it a second time.
+	time.Sleep(100 * time.Millisecond)
+	if n := len(rec.logged()); n != 2 {
+		t.Errorf("logged %d errors once the interval passed, want 2", n)
+	}
+}
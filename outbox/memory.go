@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Memory for unknown message IDs.
+var ErrNotFound = errors.New("outbox: message not found")
+
+// Memory is an in-memory Store, intended for tests and as a reference for
+// real stores.
+type Memory struct {
+	mu        sync.Mutex
+	messages  []Message
+	published map[string]bool
+	dead      map[string]bool
+}
+
+// NewMemory returns an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		published: map[string]bool{},
+		dead:      map[string]bool{},
+	}
+}
+
+// Add writes a message to the outbox.
+func (m *Memory) Add(msg Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	m.messages = append(m.messages, msg)
+}
+
+// Pending implements Store.
+func (m *Memory) Pending(ctx context.Context, now time.Time, limit int, skipDead bool) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []Message
+	// waiting holds the keys whose oldest pending message is not due, or is
+	// dead and holding back the key.
+	seen := map[string]bool{}
+	waiting := map[string]bool{}
+	for _, msg := range m.messages {
+		dead := m.dead[msg.ID]
+		if m.published[msg.ID] || (dead && skipDead) {
+			continue
+		}
+		if !seen[msg.Key] {
+			seen[msg.Key] = true
+			waiting[msg.Key] = dead || msg.NextAttempt.After(now)
+		}
+		if waiting[msg.Key] || dead {
+			continue
+		}
+		pending = append(pending, msg)
+		if limit > 0 && len(pending) == limit {
+			break
+		}
+	}
+	return pending, nil
+}
+
+// MarkPublished implements Store.
+func (m *Memory) MarkPublished(ctx context.Context, id string) error {
+	return m.update(id, func(msg *Message) {
+		m.published[id] = true
+	})
+}
+
+// RecordFailure implements Store.
+func (m *Memory) RecordFailure(ctx context.Context, id string, attempts int, next time.Time, lastError string) error {
+	return m.update(id, func(msg *Message) {
+		msg.Attempts = attempts
+		msg.NextAttempt = next
+		msg.LastError = lastError
+	})
+}
+
+// MarkDead implements Store.
+func (m *Memory) MarkDead(ctx context.Context, id string, attempts int, lastError string) error {
+	return m.update(id, func(msg *Message) {
+		msg.Attempts = attempts
+		msg.LastError = lastError
+		m.dead[id] = true
+	})
+}
+
+// Revive makes a dead message pending again with no failed attempts, eg. once
+// the reason it could not be published is fixed.
+func (m *Memory) Revive(id string) error {
+	return m.update(id, func(msg *Message) {
+		msg.Attempts = 0
+		msg.NextAttempt = time.Time{}
+		msg.LastError = ""
+		delete(m.dead, id)
+	})
+}
+
+// Dead returns the messages marked dead, for inspection in tests.
+func (m *Memory) Dead() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var dead []Message
+	for _, msg := range m.messages {
+		if m.dead[msg.ID] {
+			dead = append(dead, msg)
+		}
+	}
+	return dead
+}
+
+func (m *Memory) update(id string, fn func(*Message)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.messages {
+		if m.messages[i].ID == id {
+			fn(&m.messages[i])
+			return nil
+		}
+	}
+	return ErrNotFound
+}
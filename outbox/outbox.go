@@ -0,0 +1,222 @@
+// Package outbox relays messages from a transactional outbox to a broker.
+//
+// Messages are written to the outbox in the same transaction as the change
+// they describe, and a Relay polls the outbox and publishes them. Failed
+// publishes are retried on a backoff curve, with the attempt count and next
+// attempt time persisted in the store, and messages which exhaust their
+// attempts are marked dead. Messages sharing a key are published in order, so
+// by default a dead message holds back the rest of its key until it is dealt
+// with in the store.
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// Message is an entry in the outbox.
+type Message struct {
+	ID string
+	// Key groups messages which must be published in order, eg. an
+	// aggregate ID. Messages with different keys may be published in any
+	// order.
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+	// Attempts is the number of failed publishes so far.
+	Attempts int
+	// NextAttempt is when the message may next be published.
+	NextAttempt time.Time
+	LastError   string
+}
+
+// Store is the outbox table.
+type Store interface {
+	// Pending returns up to `limit` messages which are neither published nor
+	// dead, in the order they were written, leaving out every message of a
+	// key whose oldest such message is not due by `now`. Keys waiting on a
+	// retry are left out entirely so that they cannot fill the batch and
+	// starve the keys behind them.
+	//
+	// Unless `skipDead` is set, keys whose oldest unpublished message is
+	// dead are left out in the same way.
+	Pending(ctx context.Context, now time.Time, limit int, skipDead bool) ([]Message, error)
+	// MarkPublished records that a message was published.
+	MarkPublished(ctx context.Context, id string) error
+	// RecordFailure records a failed publish and when to try again.
+	RecordFailure(ctx context.Context, id string, attempts int, next time.Time, lastError string) error
+	// MarkDead records that a message will not be published.
+	MarkDead(ctx context.Context, id string, attempts int, lastError string) error
+}
+
+// Publisher sends messages to the broker.
+type Publisher interface {
+	Publish(ctx context.Context, m Message) error
+}
+
+// Relay moves messages from a Store to a Publisher.
+type Relay struct {
+	Store     Store
+	Publisher Publisher
+	// Curve determines how long in seconds to wait before each retry of a
+	// message, counting from 0 for the first retry.
+	Curve func(float64) float64
+	// MaxAttempts is the number of failed publishes after which a message is
+	// marked dead. If 0, messages are retried indefinitely.
+	MaxAttempts int
+	// SkipDead publishes the messages behind a dead message with the same
+	// key, giving up on the key's order. By default they are held back until
+	// the dead message is no longer dead in the store.
+	SkipDead bool
+	// BatchSize is how many pending messages to read at once. Defaults to
+	// 100.
+	BatchSize int
+	// Concurrency is how many keys are published in parallel. Defaults to 1.
+	Concurrency int
+	// PollInterval is how long to wait between batches when the outbox has
+	// nothing due. Defaults to 1 second.
+	PollInterval time.Duration
+	// LogFailure, if not nil, is called with errors from publishing and from
+	// the store.
+	LogFailure func(error)
+}
+
+// Run relays messages until ctx is done.
+func (r *Relay) Run(ctx context.Context) error {
+	if r.Store == nil || r.Publisher == nil || r.Curve == nil {
+		return backoff.ErrInvalidConfig
+	}
+
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	for {
+		published, err := r.RelayOnce(ctx)
+		if err != nil {
+			r.logFailure(err)
+		}
+		if published > 0 {
+			continue
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// RelayOnce publishes the due messages of one batch and returns how many were
+// published.
+//
+// For each key, messages are published in order, and a message which fails
+// or is not yet due holds back the later messages with its key until it is
+// published, or marked dead if SkipDead is set.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	limit := r.BatchSize
+	if limit <= 0 {
+		limit = 100
+	}
+
+	pending, err := r.Store.Pending(ctx, time.Now(), limit, r.SkipDead)
+	if err != nil {
+		return 0, err
+	}
+
+	var keys []string
+	byKey := map[string][]Message{}
+	for _, m := range pending {
+		if _, ok := byKey[m.Key]; !ok {
+			keys = append(keys, m.Key)
+		}
+		byKey[m.Key] = append(byKey[m.Key], m)
+	}
+
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	published := 0
+	sem := make(chan struct{}, concurrency)
+
+	for _, key := range keys {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(messages []Message) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			n := r.relayKey(ctx, messages)
+			mu.Lock()
+			published += n
+			mu.Unlock()
+		}(byKey[key])
+	}
+	wg.Wait()
+
+	return published, nil
+}
+
+// relayKey publishes messages sharing a key in order, stopping at the first
+// one which is not published, or not dead if SkipDead is set.
+func (r *Relay) relayKey(ctx context.Context, messages []Message) int {
+	published := 0
+	now := time.Now()
+
+	for _, m := range messages {
+		if ctx.Err() != nil || m.NextAttempt.After(now) {
+			return published
+		}
+
+		err := r.Publisher.Publish(ctx, m)
+		if err == nil {
+			if err := r.Store.MarkPublished(ctx, m.ID); err != nil {
+				r.logFailure(err)
+				return published
+			}
+			published++
+			continue
+		}
+		if ctx.Err() != nil {
+			return published
+		}
+
+		r.logFailure(err)
+		attempts := m.Attempts + 1
+		if r.MaxAttempts != 0 && attempts >= r.MaxAttempts {
+			if err := r.Store.MarkDead(ctx, m.ID, attempts, err.Error()); err != nil {
+				r.logFailure(err)
+				return published
+			}
+			if r.SkipDead {
+				continue
+			}
+			return published
+		}
+
+		next := time.Now().Add(backoff.Delay(r.Curve, attempts-1))
+		if err := r.Store.RecordFailure(ctx, m.ID, attempts, next, err.Error()); err != nil {
+			r.logFailure(err)
+		}
+		return published
+	}
+
+	return published
+}
+
+func (r *Relay) logFailure(err error) {
+	if r.LogFailure != nil {
+		r.LogFailure(err)
+	}
+}
@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func zero(float64) float64 { return 0 }
+
+// publisher records the IDs it publishes, failing those in failing.
+type publisher struct {
+	mu        sync.Mutex
+	failing   map[string]bool
+	published []string
+}
+
+func (p *publisher) Publish(ctx context.Context, m Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failing[m.ID] {
+		return errors.New("broker down")
+	}
+	p.published = append(p.published, m.ID)
+	return nil
+}
+
+func (p *publisher) setFailing(id string, failing bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failing[id] = failing
+}
+
+func (p *publisher) ids() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return fmt.Sprint(p.published)
+}
+
+func newRelay(ids ...string) (*Relay, *Memory, *publisher) {
+	store := NewMemory()
+	for _, id := range ids {
+		// Messages are keyed by their first letter.
+		store.Add(Message{ID: id, Key: id[:1]})
+	}
+	pub := &publisher{failing: map[string]bool{}}
+	return &Relay{Store: store, Publisher: pub, Curve: zero, MaxAttempts: 2}, store, pub
+}
+
+func relay(t *testing.T, r *Relay) int {
+	t.Helper()
+	n, err := r.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRetryKeepsOrder(t *testing.T) {
+	r, _, pub := newRelay("a1", "a2", "b1")
+	pub.setFailing("a1", true)
+
+	relay(t, r)
+	if got := pub.ids(); got != "[b1]" {
+		t.Fatalf("published %s, want [b1] with a held back by a1", got)
+	}
+
+	pub.setFailing("a1", false)
+	relay(t, r)
+	if got := pub.ids(); got != "[b1 a1 a2]" {
+		t.Errorf("published %s, want [b1 a1 a2]", got)
+	}
+}
+
+func TestDeadHoldsKey(t *testing.T) {
+	r, store, pub := newRelay("a1", "a2", "b1")
+	pub.setFailing("a1", true)
+
+	relay(t, r)
+	relay(t, r)
+	relay(t, r)
+
+	dead := store.Dead()
+	if len(dead) != 1 || dead[0].ID != "a1" || dead[0].Attempts != 2 {
+		t.Fatalf("dead = %v, want a1 after 2 attempts", dead)
+	}
+	if got := pub.ids(); got != "[b1]" {
+		t.Fatalf("published %s, want [b1] with a held back by dead a1", got)
+	}
+
+	pub.setFailing("a1", false)
+	if err := store.Revive("a1"); err != nil {
+		t.Fatal(err)
+	}
+	relay(t, r)
+	if got := pub.ids(); got != "[b1 a1 a2]" {
+		t.Errorf("published %s after reviving a1, want [b1 a1 a2]", got)
+	}
+}
+
+func TestSkipDead(t *testing.T) {
+	r, store, pub := newRelay("a1", "a2")
+	r.SkipDead = true
+	pub.setFailing("a1", true)
+
+	relay(t, r)
+	relay(t, r)
+
+	if dead := store.Dead(); len(dead) != 1 || dead[0].ID != "a1" {
+		t.Fatalf("dead = %v, want a1", dead)
+	}
+	if got := pub.ids(); got != "[a2]" {
+		t.Errorf("published %s, want [a2] past dead a1", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r, store, pub := newRelay("a1", "a2")
+	r.Curve = func(float64) float64 { return 60 }
+	pub.setFailing("a1", true)
+
+	relay(t, r)
+	pending, err := store.Pending(context.Background(), time.Now(), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending = %v, want none while a1 waits a minute", pending)
+	}
+
+	pending, err = store.Pending(context.Background(), time.Now().Add(time.Minute), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[0].LastError != "broker down" {
+		t.Errorf("pending after a minute = %v, want a1 with 1 attempt then a2", pending)
+	}
+}
+
+func TestPendingLeavesOutWaitingKeys(t *testing.T) {
+	store := NewMemory()
+	later := time.Now().Add(time.Hour)
+	store.Add(Message{ID: "a1", Key: "a", NextAttempt: later})
+	for i := 2; i <= 5; i++ {
+		store.Add(Message{ID: fmt.Sprintf("a%d", i), Key: "a"})
+	}
+	store.Add(Message{ID: "b1", Key: "b"})
+
+	pending, err := store.Pending(context.Background(), time.Now(), 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != "b1" {
+		t.Errorf("pending = %v, want only b1", pending)
+	}
+}
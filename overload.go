@@ -0,0 +1,84 @@
+package backoff
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// OverloadSignal reports whether the process is too busy to take on retries,
+// which would only add to the load.
+type OverloadSignal interface {
+	Overloaded() bool
+}
+
+// OverloadFunc is a custom OverloadSignal.
+type OverloadFunc func() bool
+
+// Overloaded calls f.
+func (f OverloadFunc) Overloaded() bool {
+	return f()
+}
+
+// InFlight counts operations in progress and reports overload once more than
+// Limit are running. A Limit of 0 or less means no limit.
+type InFlight struct {
+	Limit int64
+
+	count atomic.Int64
+}
+
+// Start records the start of an operation and returns a function recording
+// its end.
+func (f *InFlight) Start() (done func()) {
+	f.count.Add(1)
+	return func() {
+		f.count.Add(-1)
+	}
+}
+
+// Count returns the number of operations in progress.
+func (f *InFlight) Count() int64 {
+	return f.count.Load()
+}
+
+// Overloaded implements OverloadSignal.
+func (f *InFlight) Overloaded() bool {
+	return f.Limit > 0 && f.count.Load() > f.Limit
+}
+
+// QueueLength reports overload once the length returned by Len is more than
+// Limit, eg. the number of buffered items in a work channel. A Limit of 0 or
+// less means no limit.
+type QueueLength struct {
+	Len   func() int
+	Limit int
+}
+
+// Overloaded implements OverloadSignal.
+func (q QueueLength) Overloaded() bool {
+	return q.Limit > 0 && q.Len() > q.Limit
+}
+
+// Goroutines reports overload once more than Limit goroutines are running. A
+// Limit of 0 or less means no limit.
+type Goroutines struct {
+	Limit int
+}
+
+// Overloaded implements OverloadSignal.
+func (g Goroutines) Overloaded() bool {
+	return g.Limit > 0 && runtime.NumGoroutine() > g.Limit
+}
+
+// AnyOverloaded returns an OverloadSignal which reports overload when any of
+// `signals` does.
+func AnyOverloaded(signals ...OverloadSignal) OverloadSignal {
+	return OverloadFunc(func() bool {
+		for _, s := range signals {
+			if s.Overloaded() {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,90 @@
+package backoff
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Override adjusts the retry behaviour of every call made with a context,
+// letting code far from the call site tighten retries for a single request,
+// eg. to not retry a health check at all.
+//
+// Overrides only ever make retrying more restrictive: a cap larger than the
+// call site's own setting has no effect. When several overrides are attached
+// to the same context chain, the most restrictive value of each field wins.
+type Override struct {
+	// Disable makes a single attempt, straight away, with no retries.
+	Disable bool
+	// MaxAttempts, if not 0, caps the number of attempts, including for calls
+	// which would otherwise retry indefinitely.
+	MaxAttempts int
+	// MaxDelay, if not 0, caps the delay before each attempt.
+	MaxDelay time.Duration
+}
+
+type overrideKey struct{}
+
+// OverrideContext returns a copy of ctx carrying o, merged with any override
+// already in ctx.
+func OverrideContext(ctx context.Context, o Override) context.Context {
+	if parent, ok := OverrideFromContext(ctx); ok {
+		o = parent.merge(o)
+	}
+	return context.WithValue(ctx, overrideKey{}, o)
+}
+
+// OverrideFromContext returns the override attached to ctx, if any.
+func OverrideFromContext(ctx context.Context) (Override, bool) {
+	o, ok := ctx.Value(overrideKey{}).(Override)
+	return o, ok
+}
+
+// merge returns the most restrictive combination of o and other.
+func (o Override) merge(other Override) Override {
+	return Override{
+		Disable:     o.Disable || other.Disable,
+		MaxAttempts: minCap(o.MaxAttempts, other.MaxAttempts),
+		MaxDelay:    minDelayCap(o.MaxDelay, other.MaxDelay),
+	}
+}
+
+// apply tightens the options with o.
+func (o Override) apply(opts *options) {
+	if o.Disable {
+		opts.curve = func(float64) float64 { return 0 }
+		opts.maxAttempts = 1
+		opts.infinite = false
+		return
+	}
+
+	if o.MaxAttempts > 0 && (opts.infinite || o.MaxAttempts < opts.maxAttempts) {
+		opts.maxAttempts = o.MaxAttempts
+		opts.infinite = false
+	}
+
+	if o.MaxDelay > 0 {
+		curve := opts.curve
+		limit := o.MaxDelay.Seconds()
+		opts.curve = func(x float64) float64 {
+			return math.Min(curve(x), limit)
+		}
+	}
+}
+
+// minCap returns the smaller of two caps, where 0 means no cap.
+func minCap(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// minDelayCap is minCap for durations, which do not fit in an int on 32-bit
+// platforms.
+func minDelayCap(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,75 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOverrideMerge(t *testing.T) {
+	ctx := OverrideContext(context.Background(), Override{MaxAttempts: 3, MaxDelay: time.Second})
+	ctx = OverrideContext(ctx, Override{MaxAttempts: 5})
+	ctx = OverrideContext(ctx, Override{MaxDelay: time.Minute})
+
+	o, ok := OverrideFromContext(ctx)
+	if !ok {
+		t.Fatal("no override in context")
+	}
+	if o != (Override{MaxAttempts: 3, MaxDelay: time.Second}) {
+		t.Errorf("merged override = %+v, want the tightest of each field", o)
+	}
+
+	ctx = OverrideContext(ctx, Override{Disable: true})
+	if o, _ := OverrideFromContext(ctx); !o.Disable || o.MaxAttempts != 3 {
+		t.Errorf("merged override = %+v, want Disable kept alongside the caps", o)
+	}
+}
+
+func TestOverrideAttempts(t *testing.T) {
+	tests := []struct {
+		name     string
+		override Override
+		opts     []Option
+		want     int
+	}{
+		{"tightens", Override{MaxAttempts: 2}, []Option{WithMaxAttempts(4)}, 2},
+		{"never loosens", Override{MaxAttempts: 10}, []Option{WithMaxAttempts(4)}, 4},
+		{"caps infinite", Override{MaxAttempts: 3}, []Option{WithInfinite()}, 3},
+		{"disable", Override{Disable: true}, []Option{WithMaxAttempts(4)}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			ctx := OverrideContext(context.Background(), tt.override)
+			Do(ctx, func(context.Context) (*int, error) {
+				calls++
+				return nil, errors.New("fail")
+			}, append(tt.opts, WithCurve(zero))...)
+			if calls != tt.want {
+				t.Errorf("made %d attempts, want %d", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverrideDelay(t *testing.T) {
+	slow := func(float64) float64 { return 10 }
+
+	for name, o := range map[string]Override{
+		"max delay": {MaxDelay: 10 * time.Millisecond},
+		"disable":   {Disable: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := OverrideContext(context.Background(), o)
+			start := time.Now()
+			Do(ctx, func(context.Context) (*int, error) {
+				return nil, errors.New("fail")
+			}, WithCurve(slow), WithMaxAttempts(3), WithFractionalDelays())
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("took %s, want the 10s delays capped", elapsed)
+			}
+		})
+	}
+}
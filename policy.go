@@ -0,0 +1,55 @@
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// Policy describes how an operation is retried, separately from the operation
+// itself, so that helpers which supply their own Func can share it.
+type Policy struct {
+	// Curve is used as in Config.
+	Curve func(float64) float64
+	// MaxAttempts is used as in Config.
+	MaxAttempts int
+	// LogFailure is used as in Config.
+	LogFailure func(error)
+	// Retryable is used as in Config.
+	Retryable func(error) bool
+	// FractionalDelays is used as in Config.
+	FractionalDelays bool
+}
+
+// Retry will retry fn under the policy until it returns a non-nil value, the
+// maximum number of attempts is reached or ctx is done.
+func Retry[T any](ctx context.Context, p Policy, fn func() (*T, error)) (*T, []error) {
+	return Backoff(Config[T]{
+		Curve:            p.Curve,
+		Func:             fn,
+		MaxAttempts:      p.MaxAttempts,
+		LogFailure:       p.LogFailure,
+		Retryable:        p.Retryable,
+		FractionalDelays: p.FractionalDelays,
+		Context:          ctx,
+	})
+}
+
+// options returns the Do options equivalent to the policy.
+func (p Policy) options() []Option {
+	return Config[struct{}]{
+		Curve:            p.Curve,
+		MaxAttempts:      p.MaxAttempts,
+		LogFailure:       p.LogFailure,
+		Retryable:        p.Retryable,
+		FractionalDelays: p.FractionalDelays,
+	}.Options()
+}
+
+// Delay returns how long the policy waits before the given attempt, counting
+// from 0.
+func (p Policy) Delay(attempt int) time.Duration {
+	if p.FractionalDelays {
+		return FractionalDelay(p.Curve, attempt)
+	}
+	return Delay(p.Curve, attempt)
+}
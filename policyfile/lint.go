@@ -0,0 +1,126 @@
+package policyfile
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Severity is how serious a finding is.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rules reported by Lint.
+const (
+	RuleInvalid          = "invalid"
+	RuleUnboundedRetry   = "unbounded-retry"
+	RuleWorstCaseTime    = "worst-case-time"
+	RuleDecreasingCurve  = "decreasing-curve"
+	RuleTimeoutOverDelay = "timeout-over-delay"
+)
+
+// Finding is a problem found in a policy.
+type Finding struct {
+	Policy   string   `json:"policy"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// LintOptions configures Lint.
+type LintOptions struct {
+	// MaxTotal is the longest a policy may take to give up, counting every
+	// delay and attempt timeout. If 0, worst-case time is not checked.
+	MaxTotal time.Duration
+	// Horizon is how many attempts of an infinite policy are examined for
+	// decreasing curves. Defaults to 100.
+	Horizon int
+}
+
+// Lint checks p for dangerous settings.
+func Lint(p Policy, opts LintOptions) []Finding {
+	var findings []Finding
+	report := func(rule string, severity Severity, format string, args ...any) {
+		findings = append(findings, Finding{
+			Policy:   p.Name,
+			Rule:     rule,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	curve, err := p.validate()
+	if err != nil {
+		report(RuleInvalid, SeverityError, "%v", err)
+		return findings
+	}
+
+	if p.MaxAttempts == 0 {
+		switch {
+		case p.Jitter == 0 && !p.Context:
+			report(RuleUnboundedRetry, SeverityError, "retries indefinitely without jitter or a context to stop it")
+		case p.Jitter == 0:
+			report(RuleUnboundedRetry, SeverityWarning, "retries indefinitely without jitter")
+		case !p.Context:
+			report(RuleUnboundedRetry, SeverityWarning, "retries indefinitely without a context to stop it")
+		}
+	}
+
+	attempts := p.MaxAttempts
+	if attempts == 0 {
+		attempts = opts.Horizon
+		if attempts <= 0 {
+			attempts = 100
+		}
+	}
+
+	// Jitter only shortens delays, so the curve without it gives the worst
+	// case. Times are summed in seconds, as steep curves soon overflow a
+	// time.Duration.
+	timeout := time.Duration(p.AttemptTimeout).Seconds()
+	var total, shortest float64
+	shorter := 0
+	decreases := -1
+	for i := 0; i < attempts; i++ {
+		delay := curve(float64(i))
+		total += delay + timeout
+		if i > 0 && delay < timeout {
+			if shorter == 0 || delay < shortest {
+				shortest = delay
+			}
+			shorter++
+		}
+		if i > 0 && decreases < 0 && delay < curve(float64(i-1)) {
+			decreases = i
+		}
+	}
+
+	if decreases > 0 {
+		report(RuleDecreasingCurve, SeverityWarning, "curve decreases from attempt %d to %d (%.3gs to %.3gs)",
+			decreases-1, decreases, curve(float64(decreases-1)), curve(float64(decreases)))
+	}
+
+	if p.MaxAttempts != 0 && opts.MaxTotal > 0 && !(total <= opts.MaxTotal.Seconds()) {
+		report(RuleWorstCaseTime, SeverityError, "may take %s to give up, more than %s", seconds(total), opts.MaxTotal)
+	}
+
+	if shorter > 0 {
+		report(RuleTimeoutOverDelay, SeverityWarning, "attempt timeout %s is longer than the delay before %d of %d retries (as short as %s)",
+			time.Duration(p.AttemptTimeout), shorter, attempts-1, seconds(shortest))
+	}
+
+	return findings
+}
+
+// seconds formats a number of seconds as a duration, falling back to
+// scientific notation for values too large for a time.Duration.
+func seconds(s float64) string {
+	if s >= float64(math.MaxInt64)/float64(time.Second) || math.IsNaN(s) {
+		return fmt.Sprintf("%.3gs", s)
+	}
+	return time.Duration(s * float64(time.Second)).String()
+}
@@ -0,0 +1,191 @@
+// Package policyfile loads retry policies from declarative JSON files, so that
+// they can be reviewed and checked outside of the code using them.
+//
+// A policy file looks like:
+//
+//	{
+//	  "policies": [
+//	    {
+//	      "name": "payments",
+//	      "curve": {"type": "exponential", "base": 2, "mul": 0.5},
+//	      "max_attempts": 8,
+//	      "jitter": 0.5,
+//	      "attempt_timeout": "10s",
+//	      "context": true
+//	    }
+//	  ]
+//	}
+package policyfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// File is the contents of a policy file.
+type File struct {
+	Policies []Policy `json:"policies"`
+}
+
+// Policy is a declarative retry policy.
+type Policy struct {
+	Name  string `json:"name"`
+	Curve Curve  `json:"curve"`
+	// MaxAttempts is used as in backoff.Config, with 0 retrying indefinitely.
+	MaxAttempts int `json:"max_attempts"`
+	// Jitter is the factor passed to backoff.Jitter, between 0 for none and
+	// 1.
+	Jitter float64 `json:"jitter"`
+	// AttemptTimeout is how long each attempt may run, or 0 for no limit.
+	AttemptTimeout Duration `json:"attempt_timeout"`
+	// Context declares that calls using the policy are bound by a context
+	// which can stop them, eg. a request deadline.
+	Context bool `json:"context"`
+}
+
+// Curve describes one of the curves in the backoff package.
+//
+// Type selects the curve, and the fields used are:
+//   - "default": Attempts and Limit, as in backoff.Default.
+//   - "linear": Mul, as in backoff.Linear.
+//   - "exponential": Base and Mul, as in backoff.Exponential.
+//   - "logistic": K, Limit and Midpoint, as in backoff.Logistic.
+//   - "constant": Value, returned for every attempt.
+type Curve struct {
+	Type     string  `json:"type"`
+	Attempts int     `json:"attempts,omitempty"`
+	Limit    float64 `json:"limit,omitempty"`
+	Mul      float64 `json:"mul,omitempty"`
+	Base     float64 `json:"base,omitempty"`
+	K        float64 `json:"k,omitempty"`
+	Midpoint float64 `json:"midpoint,omitempty"`
+	Value    float64 `json:"value,omitempty"`
+}
+
+// Func returns the curve function described by c.
+func (c Curve) Func() (func(float64) float64, error) {
+	switch c.Type {
+	case "default":
+		if c.Attempts <= 0 {
+			return nil, fmt.Errorf("default curve needs attempts greater than 0")
+		}
+		return backoff.Default(c.Attempts, c.Limit), nil
+	case "linear":
+		return func(x float64) float64 {
+			return backoff.Linear(x, c.Mul)
+		}, nil
+	case "exponential":
+		return func(x float64) float64 {
+			return backoff.Exponential(x, c.Base, c.Mul)
+		}, nil
+	case "logistic":
+		return func(x float64) float64 {
+			return backoff.Logistic(x, c.K, c.Limit, c.Midpoint)
+		}, nil
+	case "constant":
+		return func(float64) float64 {
+			return c.Value
+		}, nil
+	case "":
+		return nil, fmt.Errorf("curve type is required")
+	default:
+		return nil, fmt.Errorf("unknown curve type %q", c.Type)
+	}
+}
+
+// Backoff returns the policy as a backoff.Policy, with jitter applied to its
+// curve, or an error if the policy is invalid.
+//
+// AttemptTimeout and Context have no counterpart in backoff.Policy, so they
+// are left to the caller: AttemptContext applies the timeout to an attempt,
+// and Context only informs Lint.
+func (p Policy) Backoff() (backoff.Policy, error) {
+	curve, err := p.validate()
+	if err != nil {
+		return backoff.Policy{}, fmt.Errorf("policy %q: %w", p.Name, err)
+	}
+	if p.Jitter > 0 {
+		curve = backoff.Jitter(curve, p.Jitter)
+	}
+	return backoff.Policy{Curve: curve, MaxAttempts: p.MaxAttempts}, nil
+}
+
+// AttemptContext returns a copy of ctx for a single attempt, cancelled once
+// AttemptTimeout has passed if it is set.
+func (p Policy) AttemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.AttemptTimeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(p.AttemptTimeout))
+	}
+	return context.WithCancel(ctx)
+}
+
+// validate checks the fields of p, returning its curve without jitter.
+func (p Policy) validate() (func(float64) float64, error) {
+	curve, err := p.Curve.Func()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.MaxAttempts < 0:
+		return nil, fmt.Errorf("max_attempts must not be negative")
+	case p.Jitter < 0 || p.Jitter > 1:
+		return nil, fmt.Errorf("jitter must be between 0 and 1")
+	case p.AttemptTimeout < 0:
+		return nil, fmt.Errorf("attempt_timeout must not be negative")
+	}
+	return curve, nil
+}
+
+// Parse reads a policy file from r.
+func Parse(r io.Reader) (*File, error) {
+	var f File
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Load reads the policy file at `path`.
+func Load(path string) (*File, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Duration is a time.Duration written in JSON as a string such as "1m30s".
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,170 @@
+package policyfile
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func constant(v float64) Curve {
+	return Curve{Type: "constant", Value: v}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		opts   LintOptions
+		// want lists the findings as rule:severity.
+		want []string
+	}{
+		{
+			name:   "clean",
+			policy: Policy{Curve: constant(1), MaxAttempts: 3},
+		},
+		{
+			name:   "unknown curve",
+			policy: Policy{Curve: Curve{Type: "cubic"}, MaxAttempts: 3},
+			want:   []string{"invalid:error"},
+		},
+		{
+			name:   "negative max attempts",
+			policy: Policy{Curve: constant(1), MaxAttempts: -1},
+			want:   []string{"invalid:error"},
+		},
+		{
+			name:   "jitter above 1",
+			policy: Policy{Curve: constant(1), MaxAttempts: 3, Jitter: 1.5},
+			want:   []string{"invalid:error"},
+		},
+		{
+			name:   "negative jitter",
+			policy: Policy{Curve: constant(1), MaxAttempts: 3, Jitter: -0.1},
+			want:   []string{"invalid:error"},
+		},
+		{
+			name:   "unbounded",
+			policy: Policy{Curve: constant(1)},
+			want:   []string{"unbounded-retry:error"},
+		},
+		{
+			name:   "unbounded with jitter",
+			policy: Policy{Curve: constant(1), Jitter: 0.5},
+			want:   []string{"unbounded-retry:warning"},
+		},
+		{
+			name:   "unbounded with context",
+			policy: Policy{Curve: constant(1), Context: true},
+			want:   []string{"unbounded-retry:warning"},
+		},
+		{
+			name:   "unbounded with jitter and context",
+			policy: Policy{Curve: constant(1), Jitter: 0.5, Context: true},
+		},
+		{
+			name:   "worst case time",
+			policy: Policy{Curve: constant(10), MaxAttempts: 5, AttemptTimeout: Duration(time.Second)},
+			opts:   LintOptions{MaxTotal: time.Minute},
+		},
+		{
+			name:   "worst case time exceeded",
+			policy: Policy{Curve: constant(10), MaxAttempts: 5, AttemptTimeout: Duration(5 * time.Second)},
+			opts:   LintOptions{MaxTotal: time.Minute},
+			want:   []string{"worst-case-time:error"},
+		},
+		{
+			name:   "worst case time overflow",
+			policy: Policy{Curve: Curve{Type: "exponential", Base: 10, Mul: 1}, MaxAttempts: 400},
+			opts:   LintOptions{MaxTotal: time.Hour},
+			want:   []string{"worst-case-time:error"},
+		},
+		{
+			name:   "decreasing curve",
+			policy: Policy{Curve: Curve{Type: "exponential", Base: 0.5, Mul: 8}, MaxAttempts: 3},
+			want:   []string{"decreasing-curve:warning"},
+		},
+		{
+			name:   "timeout over delay",
+			policy: Policy{Curve: constant(1), MaxAttempts: 3, AttemptTimeout: Duration(5 * time.Second)},
+			want:   []string{"timeout-over-delay:warning"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range Lint(tt.policy, tt.opts) {
+				got = append(got, f.Rule+":"+string(f.Severity))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Lint = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, p := range []Policy{
+		{Name: "negative", Curve: constant(1), MaxAttempts: -1},
+		{Name: "jitter", Curve: constant(1), Jitter: 2},
+		{Name: "timeout", Curve: constant(1), AttemptTimeout: Duration(-time.Second)},
+		{Name: "curve"},
+	} {
+		if _, err := p.Backoff(); err == nil || !strings.Contains(err.Error(), p.Name) {
+			t.Errorf("Backoff of %s policy = %v, want an error naming it", p.Name, err)
+		}
+	}
+
+	policy, err := Policy{Curve: constant(2), MaxAttempts: 3, Jitter: 0.5}.Backoff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MaxAttempts != 3 {
+		t.Errorf("MaxAttempts = %d, want 3", policy.MaxAttempts)
+	}
+	for i := 0; i < 100; i++ {
+		if v := policy.Curve(0); v < 1 || v > 2 {
+			t.Fatalf("jittered curve = %v, want between 1 and 2", v)
+		}
+	}
+}
+
+func TestAttemptContext(t *testing.T) {
+	ctx, cancel := Policy{AttemptTimeout: Duration(time.Second)}.AttemptContext(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Errorf("deadline = %v, %v, want within a second", deadline, ok)
+	}
+
+	ctx, cancel = Policy{}.AttemptContext(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("deadline set without an attempt timeout")
+	}
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(`{"policies": [{
+		"name": "payments",
+		"curve": {"type": "exponential", "base": 2, "mul": 0.5},
+		"max_attempts": 8,
+		"jitter": 0.5,
+		"attempt_timeout": "10s",
+		"context": true
+	}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := f.Policies[0]
+	if p.Name != "payments" || p.Curve.Base != 2 || p.MaxAttempts != 8 || p.AttemptTimeout != Duration(10*time.Second) || !p.Context {
+		t.Errorf("parsed %+v", p)
+	}
+
+	if _, err := Parse(strings.NewReader(`{"policies": [{"name": "x", "retries": 3}]}`)); err == nil {
+		t.Error("Parse accepted an unknown field")
+	}
+	if _, err := Parse(strings.NewReader(`{"policies": [{"attempt_timeout": 10}]}`)); err == nil {
+		t.Error("Parse accepted a numeric duration")
+	}
+}
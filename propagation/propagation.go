@@ -0,0 +1,257 @@
+// Package propagation carries retry attempt information between services so
+// that servers can tell first attempts apart from retries.
+//
+// Clients stamp the attempt number and remaining retry budget on outgoing
+// requests, either as HTTP headers or as gRPC metadata. Servers read them back
+// into the request context, where they can be used to tag metrics and to
+// suppress retries further downstream while an upstream caller is already
+// retrying.
+//
+// The package does not depend on gRPC, so its interceptors are left to the
+// caller: a client interceptor calls InjectMetadata on the outgoing metadata
+// with the Info from FromContext, and a server interceptor passes the incoming
+// metadata to IncomingContext.
+//
+//	func client(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+//		if info, ok := propagation.FromContext(ctx); ok {
+//			md, _ := metadata.FromOutgoingContext(ctx)
+//			md = md.Copy()
+//			propagation.InjectMetadata(md, info)
+//			ctx = metadata.NewOutgoingContext(ctx, md)
+//		}
+//		return invoker(ctx, method, req, reply, cc, opts...)
+//	}
+//
+//	func server(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+//		md, _ := metadata.FromIncomingContext(ctx)
+//		return handler(propagation.IncomingContext(ctx, md), req)
+//	}
+package propagation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zaptross/backoff"
+)
+
+const (
+	// HeaderAttempt is the HTTP header holding the attempt number, starting
+	// at 1 for the first attempt.
+	HeaderAttempt = "X-Retry-Attempt"
+	// HeaderRemaining is the HTTP header holding the number of attempts left
+	// after this one, or -1 if the caller retries indefinitely.
+	HeaderRemaining = "X-Retry-Remaining"
+)
+
+// Unlimited is the value of Info.Remaining when the caller retries
+// indefinitely.
+const Unlimited = -1
+
+// Info describes where a request sits in its caller's retry loop.
+type Info struct {
+	// Attempt is the attempt number, starting at 1 for the first attempt.
+	Attempt int
+	// Remaining is the number of attempts the caller will still make if this
+	// one fails, or Unlimited.
+	Remaining int
+}
+
+// Retrying reports whether the request is a retry rather than a first attempt.
+func (i Info) Retrying() bool {
+	return i.Attempt > 1
+}
+
+// Inject sets the retry headers on h.
+func Inject(h http.Header, info Info) {
+	h.Set(HeaderAttempt, strconv.Itoa(info.Attempt))
+	h.Set(HeaderRemaining, strconv.Itoa(info.Remaining))
+}
+
+// Extract reads the retry headers from h. The second return value is false if
+// the attempt header is missing or malformed.
+func Extract(h http.Header) (Info, bool) {
+	return parse(h.Get(HeaderAttempt), h.Get(HeaderRemaining))
+}
+
+// InjectMetadata sets the retry keys on gRPC metadata. metadata.MD is a
+// map[string][]string, so it can be passed directly.
+func InjectMetadata(md map[string][]string, info Info) {
+	md[metadataKey(HeaderAttempt)] = []string{strconv.Itoa(info.Attempt)}
+	md[metadataKey(HeaderRemaining)] = []string{strconv.Itoa(info.Remaining)}
+}
+
+// ExtractMetadata reads the retry keys from gRPC metadata. The second return
+// value is false if the attempt key is missing or malformed.
+func ExtractMetadata(md map[string][]string) (Info, bool) {
+	return parse(first(md[metadataKey(HeaderAttempt)]), first(md[metadataKey(HeaderRemaining)]))
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying info.
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the Info stored in ctx, if any.
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(contextKey{}).(Info)
+	return info, ok
+}
+
+// Backoff runs conf with backoff.Backoff, calling fn with the Info for each
+// attempt in place of conf.Func. fn is expected to pass the Info on, either
+// with Inject or by attaching it to the request context with NewContext and
+// sending the request through a Transport.
+//
+// Attempts are numbered by the engine, afresh for every call, so attempts
+// shed under overload are counted and an Override on conf.Context is taken
+// into account.
+func Backoff[T any](conf backoff.Config[T], fn func(Info) (*T, error)) (*T, []error) {
+	if fn == nil {
+		return nil, []error{backoff.ErrInvalidConfig}
+	}
+
+	ctx := conf.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	limit := attemptLimit(ctx, conf.MaxAttempts)
+	var info Info
+	opts := append(conf.Options(), backoff.WithHooks(backoff.Hooks{
+		BeforeAttempt: func(attempt int) {
+			info = Info{Attempt: attempt + 1, Remaining: Unlimited}
+			if limit != Unlimited {
+				info.Remaining = limit - info.Attempt
+			}
+		},
+	}))
+
+	res, err := backoff.Do(ctx, func(context.Context) (*T, error) {
+		return fn(info)
+	}, opts...)
+	if res != nil {
+		return res, nil
+	}
+
+	var retryErr *backoff.RetryError
+	if errors.As(err, &retryErr) {
+		return nil, retryErr.Errors
+	}
+	return nil, []error{err}
+}
+
+// attemptLimit returns how many attempts the engine makes for a config's
+// MaxAttempts, after any Override attached to ctx, or Unlimited.
+func attemptLimit(ctx context.Context, maxAttempts int) int {
+	limit := maxAttempts
+	if limit == 0 {
+		limit = Unlimited
+	} else if limit < 0 {
+		limit = 1
+	}
+
+	if o, ok := backoff.OverrideFromContext(ctx); ok {
+		if o.Disable {
+			return 1
+		}
+		if o.MaxAttempts > 0 && (limit == Unlimited || o.MaxAttempts < limit) {
+			limit = o.MaxAttempts
+		}
+	}
+	return limit
+}
+
+// Limit returns a copy of conf that makes a single attempt if ctx shows the
+// upstream caller is already retrying, so that retries do not multiply at
+// every layer of a call chain.
+func Limit[T any](ctx context.Context, conf backoff.Config[T]) backoff.Config[T] {
+	if info, ok := FromContext(ctx); ok && info.Retrying() {
+		conf.MaxAttempts = 1
+	}
+	return conf
+}
+
+// Transport is an http.RoundTripper that stamps the Info found in each
+// request's context onto its headers.
+type Transport struct {
+	// Base is the RoundTripper used to send requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	info, ok := FromContext(req.Context())
+	if !ok {
+		return base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	Inject(req.Header, info)
+	return base.RoundTrip(req)
+}
+
+// Middleware returns a handler that reads the retry headers of each request
+// into its context before calling next.
+//
+// If observe is not nil, it is called with the Info of every request carrying
+// retry headers, which is the place to tag metrics.
+func Middleware(next http.Handler, observe func(*http.Request, Info)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok := Extract(r.Header)
+		if ok {
+			r = r.WithContext(NewContext(r.Context(), info))
+			if observe != nil {
+				observe(r, info)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IncomingContext reads the retry keys from incoming gRPC metadata into ctx.
+// It is meant to be called from a server interceptor with the metadata from
+// metadata.FromIncomingContext.
+func IncomingContext(ctx context.Context, md map[string][]string) context.Context {
+	if info, ok := ExtractMetadata(md); ok {
+		return NewContext(ctx, info)
+	}
+	return ctx
+}
+
+func parse(attempt, remaining string) (Info, bool) {
+	n, err := strconv.Atoi(attempt)
+	if err != nil || n < 1 {
+		return Info{}, false
+	}
+
+	info := Info{Attempt: n, Remaining: Unlimited}
+	if r, err := strconv.Atoi(remaining); err == nil && r >= Unlimited {
+		info.Remaining = r
+	}
+	return info, true
+}
+
+// metadataKey converts a header name to gRPC's lowercase metadata key form.
+func metadataKey(header string) string {
+	return strings.ToLower(header)
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,92 @@
+package propagation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/zaptross/backoff"
+)
+
+func zero(float64) float64 { return 0 }
+
+// attempts runs Backoff with conf until it gives up, returning the Info of
+// every attempt.
+func attempts(conf backoff.Config[int]) []Info {
+	var infos []Info
+	Backoff(conf, func(info Info) (*int, error) {
+		infos = append(infos, info)
+		return nil, errors.New("down")
+	})
+	return infos
+}
+
+func TestBackoffNumbering(t *testing.T) {
+	shed := 0
+	tests := []struct {
+		name string
+		conf backoff.Config[int]
+		want string
+	}{
+		{
+			name: "limited",
+			conf: backoff.Config[int]{Curve: zero, MaxAttempts: 3},
+			want: "[{1 2} {2 1} {3 0}]",
+		},
+		{
+			name: "negative",
+			conf: backoff.Config[int]{Curve: zero, MaxAttempts: -1},
+			want: "[{1 0}]",
+		},
+		{
+			name: "override",
+			conf: backoff.Config[int]{
+				Curve:   zero,
+				Context: backoff.OverrideContext(context.Background(), backoff.Override{MaxAttempts: 2}),
+			},
+			want: "[{1 1} {2 0}]",
+		},
+		{
+			name: "shed",
+			conf: backoff.Config[int]{
+				Curve:       zero,
+				MaxAttempts: 3,
+				Overload: backoff.OverloadFunc(func() bool {
+					shed++
+					return shed == 1
+				}),
+			},
+			want: "[{1 2} {3 0}]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(attempts(tt.conf)); got != tt.want {
+				t.Errorf("attempts = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	h := http.Header{}
+	Inject(h, Info{Attempt: 2, Remaining: Unlimited})
+	if info, ok := Extract(h); !ok || info != (Info{Attempt: 2, Remaining: Unlimited}) {
+		t.Errorf("Extract = %v, %v", info, ok)
+	}
+
+	md := map[string][]string{}
+	InjectMetadata(md, Info{Attempt: 1, Remaining: 4})
+	ctx := IncomingContext(context.Background(), md)
+	if info, ok := FromContext(ctx); !ok || info != (Info{Attempt: 1, Remaining: 4}) {
+		t.Errorf("FromContext = %v, %v", info, ok)
+	}
+
+	h.Set(HeaderAttempt, "0")
+	if _, ok := Extract(h); ok {
+		t.Error("Extract accepted attempt 0")
+	}
+}
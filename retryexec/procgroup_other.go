@@ -0,0 +1,14 @@
+//go:build !unix
+
+package retryexec
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(p *os.Process) {
+	p.Kill()
+}
@@ -0,0 +1,197 @@
+// Package retryexec runs subprocesses under a retry policy.
+//
+// Each attempt runs a fresh command from a factory, in its own process group
+// so that the whole tree can be killed when an attempt times out. Failures are
+// classified as retryable by exit code or stderr, and the output of every
+// attempt is kept in the Result.
+package retryexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// ErrNotRetryable is returned when an attempt fails in a way the options do
+// not consider retryable.
+var ErrNotRetryable = errors.New("retryexec: failure not retryable")
+
+// Options configures Run.
+type Options struct {
+	// Policy is used to retry failed attempts.
+	Policy backoff.Policy
+	// AttemptTimeout, if not 0, limits how long each attempt may run before
+	// its process group is killed. Timed out attempts are always retryable.
+	AttemptTimeout time.Duration
+	// RetryableExitCodes lists exit codes which are worth retrying.
+	RetryableExitCodes []int
+	// RetryableStderr lists patterns which make a failure worth retrying when
+	// they match the attempt's stderr.
+	//
+	// If neither RetryableExitCodes nor RetryableStderr is set, every failure
+	// is retryable.
+	RetryableStderr []*regexp.Regexp
+}
+
+// Attempt is the outcome of running one command.
+type Attempt struct {
+	Stdout []byte
+	Stderr []byte
+	// ExitCode is the command's exit code, or -1 if it did not start or was
+	// killed by a signal.
+	ExitCode int
+	Duration time.Duration
+	// TimedOut is true if the attempt was killed for running past
+	// AttemptTimeout.
+	TimedOut bool
+	// Err is the error from starting or waiting on the command, if any.
+	Err error
+}
+
+// Result holds every attempt made by Run.
+type Result struct {
+	Attempts []Attempt
+	// Succeeded is true if the last attempt exited with code 0.
+	Succeeded bool
+}
+
+// Last returns the last attempt, or nil if none were made.
+func (r *Result) Last() *Attempt {
+	if len(r.Attempts) == 0 {
+		return nil
+	}
+	return &r.Attempts[len(r.Attempts)-1]
+}
+
+// Run runs commands made by factory until one succeeds, retrying retryable
+// failures under the options' policy.
+//
+// factory is called for every attempt and must return a new, unstarted
+// command. Its Stdout and Stderr are captured, and also written to any
+// writers the factory set.
+func Run(ctx context.Context, factory func(ctx context.Context) *exec.Cmd, opts Options) (*Result, error) {
+	result := &Result{}
+
+	// A failure which is not retryable stops the loop by cancelling runCtx.
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	var permanent error
+
+	_, errs := backoff.Retry(runCtx, opts.Policy, func() (*Attempt, error) {
+		attempt := runAttempt(runCtx, factory, opts.AttemptTimeout)
+		result.Attempts = append(result.Attempts, attempt)
+
+		err := attemptError(attempt)
+		if err == nil {
+			result.Succeeded = true
+			return &result.Attempts[len(result.Attempts)-1], nil
+		}
+		if !attempt.TimedOut && !opts.retryable(attempt) {
+			permanent = fmt.Errorf("%w: %v", ErrNotRetryable, err)
+			stop()
+			return nil, permanent
+		}
+		return nil, err
+	})
+
+	if result.Succeeded {
+		return result, nil
+	}
+	if permanent != nil {
+		return result, permanent
+	}
+	return result, &backoff.RetryError{Errors: errs}
+}
+
+func (o Options) retryable(attempt Attempt) bool {
+	if len(o.RetryableExitCodes) == 0 && len(o.RetryableStderr) == 0 {
+		return true
+	}
+	for _, code := range o.RetryableExitCodes {
+		if attempt.ExitCode == code {
+			return true
+		}
+	}
+	for _, pattern := range o.RetryableStderr {
+		if pattern.Match(attempt.Stderr) {
+			return true
+		}
+	}
+	return false
+}
+
+func runAttempt(ctx context.Context, factory func(ctx context.Context) *exec.Cmd, timeout time.Duration) Attempt {
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := factory(attemptCtx)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = tee(&stdout, cmd.Stdout)
+	cmd.Stderr = tee(&stderr, cmd.Stderr)
+	setProcessGroup(cmd)
+
+	start := time.Now()
+	attempt := Attempt{ExitCode: -1}
+
+	if err := cmd.Start(); err != nil {
+		attempt.Err = err
+		attempt.Duration = time.Since(start)
+		return attempt
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-attemptCtx.Done():
+			killProcessGroup(cmd.Process)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+
+	attempt.Duration = time.Since(start)
+	attempt.Stdout = stdout.Bytes()
+	attempt.Stderr = stderr.Bytes()
+	attempt.ExitCode = cmd.ProcessState.ExitCode()
+	attempt.Err = err
+
+	// The process may have been killed by us or, with exec.CommandContext,
+	// by the exec package, so the timeout is judged from the contexts. Only
+	// the attempt's own timeout counts; the caller's ctx being done ends
+	// retrying anyway.
+	attempt.TimedOut = err != nil && attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+
+	return attempt
+}
+
+func attemptError(attempt Attempt) error {
+	switch {
+	case attempt.TimedOut:
+		return fmt.Errorf("retryexec: attempt timed out after %s", attempt.Duration.Round(time.Millisecond))
+	case attempt.Err != nil:
+		return attempt.Err
+	case attempt.ExitCode != 0:
+		return fmt.Errorf("retryexec: exit code %d", attempt.ExitCode)
+	}
+	return nil
+}
+
+func tee(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
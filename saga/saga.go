@@ -0,0 +1,177 @@
+// Package saga runs multi-step operations where each step is retried under
+// its own policy, and completed steps are compensated in reverse order if a
+// later step fails for good.
+package saga
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// Step is one step of a saga.
+type Step struct {
+	Name string
+	// Action performs the step.
+	Action func(ctx context.Context) error
+	// Compensate undoes the step after a later step fails. It may be nil for
+	// steps with nothing to undo.
+	Compensate func(ctx context.Context) error
+	// Policy is used to retry Action.
+	Policy backoff.Policy
+	// CompensationPolicy is used to retry Compensate. If its Curve is nil,
+	// Policy is used instead. As compensation is not stopped by ctx, the
+	// policy used must have a MaxAttempts.
+	CompensationPolicy backoff.Policy
+}
+
+// Phase is which function of a step an entry is about.
+type Phase string
+
+const (
+	PhaseAction       Phase = "action"
+	PhaseCompensation Phase = "compensation"
+)
+
+// Entry records a single attempt in the execution log.
+type Entry struct {
+	Step  string
+	Phase Phase
+	// Attempt is the attempt number, starting at 1.
+	Attempt  int
+	Start    time.Time
+	Duration time.Duration
+	// Err is the error returned by the attempt, or nil if it succeeded.
+	Err error
+}
+
+// Error is returned when a step fails for good.
+type Error struct {
+	// Step is the name of the step which failed.
+	Step string
+	// Err is the step's RetryError, or ctx's error.
+	Err error
+	// CompensationErrors holds a RetryError for each step which could not be
+	// compensated. If empty, every completed step was compensated.
+	CompensationErrors map[string]error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("saga: step %s failed: %v", e.Step, e.Err)
+	if len(e.CompensationErrors) == 0 {
+		return msg
+	}
+
+	var steps []string
+	for step := range e.CompensationErrors {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	return fmt.Sprintf("%s; compensation failed for %s", msg, strings.Join(steps, ", "))
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Execute runs the steps in order. If a step fails for good, the steps
+// completed before it are compensated in reverse order and an *Error is
+// returned. If a step is invalid, an error is returned before any step runs.
+//
+// Compensation runs even if ctx is done, as leaving steps half applied is
+// usually worse than finishing late; values from ctx are still available to
+// it. Every attempt, of actions and compensations, is recorded in the log.
+func Execute(ctx context.Context, steps []Step) ([]Entry, error) {
+	for _, step := range steps {
+		if err := step.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var log []Entry
+
+	for i, step := range steps {
+		if err := run(ctx, step.Name, PhaseAction, step.Action, step.Policy, &log); err != nil {
+			sagaErr := &Error{Step: step.Name, Err: err}
+
+			compensateCtx := detached{ctx}
+			for j := i - 1; j >= 0; j-- {
+				done := steps[j]
+				if done.Compensate == nil {
+					continue
+				}
+
+				if err := run(compensateCtx, done.Name, PhaseCompensation, done.Compensate, done.compensationPolicy(), &log); err != nil {
+					if sagaErr.CompensationErrors == nil {
+						sagaErr.CompensationErrors = map[string]error{}
+					}
+					sagaErr.CompensationErrors[done.Name] = err
+				}
+			}
+
+			return log, sagaErr
+		}
+	}
+
+	return log, nil
+}
+
+func (s Step) validate() error {
+	if s.Action == nil {
+		return fmt.Errorf("saga: step %q has no Action", s.Name)
+	}
+	if s.Compensate != nil && s.compensationPolicy().MaxAttempts == 0 {
+		return fmt.Errorf("saga: step %q would retry compensation indefinitely", s.Name)
+	}
+	return nil
+}
+
+func (s Step) compensationPolicy() backoff.Policy {
+	if s.CompensationPolicy.Curve == nil {
+		return s.Policy
+	}
+	return s.CompensationPolicy
+}
+
+// run retries fn under policy, logging each attempt.
+func run(
+	ctx context.Context,
+	step string,
+	phase Phase,
+	fn func(context.Context) error,
+	policy backoff.Policy,
+	log *[]Entry,
+) error {
+	attempt := 0
+	res, errs := backoff.Retry(ctx, policy, func() (*struct{}, error) {
+		attempt++
+		entry := Entry{Step: step, Phase: phase, Attempt: attempt, Start: time.Now()}
+		err := fn(ctx)
+		entry.Duration = time.Since(entry.Start)
+		entry.Err = err
+		*log = append(*log, entry)
+
+		if err != nil {
+			return nil, err
+		}
+		return &struct{}{}, nil
+	})
+	if res != nil {
+		return nil
+	}
+	return &backoff.RetryError{Errors: errs}
+}
+
+// detached is a context which keeps its parent's values but is never done.
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (d detached) Done() <-chan struct{}       { return nil }
+func (d detached) Err() error                  { return nil }
+func (d detached) Value(key any) any           { return d.parent.Value(key) }
@@ -0,0 +1,197 @@
+// Package scheduler shares retry capacity fairly between tenants.
+//
+// A Scheduler caps how many retries run at once, both overall and per tenant,
+// and hands free slots to waiting retries in priority order, so that one
+// tenant retrying heavily cannot starve the others.
+package scheduler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zaptross/backoff"
+)
+
+// Priority orders waiting retries. Higher priorities are scheduled first, and
+// retries of equal priority are scheduled in the order they started waiting.
+type Priority int
+
+const (
+	Low Priority = iota
+	Normal
+	High
+)
+
+// Scheduler hands out slots for running retries.
+type Scheduler struct {
+	mu           sync.Mutex
+	limit        int
+	tenantLimit  int
+	tenantLimits map[string]int
+	running      int
+	tenants      map[string]int
+	waiting      []*waiter
+	seq          uint64
+}
+
+type waiter struct {
+	tenant   string
+	priority Priority
+	seq      uint64
+	ready    chan struct{}
+}
+
+// New returns a Scheduler which runs at most `limit` retries at once, and at
+// most `tenantLimit` for any one tenant. A limit of 0 means no limit.
+func New(limit, tenantLimit int) *Scheduler {
+	return &Scheduler{
+		limit:        limit,
+		tenantLimit:  tenantLimit,
+		tenantLimits: map[string]int{},
+		tenants:      map[string]int{},
+	}
+}
+
+// SetTenantLimit overrides the per-tenant limit for `tenant`. A limit of 0
+// means no limit.
+func (s *Scheduler) SetTenantLimit(tenant string, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tenantLimits[tenant] = limit
+	s.dispatch()
+}
+
+// Acquire waits for a slot for `tenant` and returns a function which gives it
+// back. It returns ctx's error if ctx is done first.
+func (s *Scheduler) Acquire(ctx context.Context, tenant string, priority Priority) (release func(), err error) {
+	s.mu.Lock()
+	w := &waiter{
+		tenant:   tenant,
+		priority: priority,
+		seq:      s.seq,
+		ready:    make(chan struct{}),
+	}
+	s.seq++
+	s.enqueue(w)
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(tenant), nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		// The slot was granted while ctx was being cancelled.
+		s.release(tenant)
+	default:
+		s.remove(w)
+	}
+	return nil, ctx.Err()
+}
+
+// Do calls backoff.Do with fn, running every retry in a slot from s. The
+// first attempt runs straight away, as only retries compete for capacity. If
+// ctx is done while waiting, the attempt fails with ctx's error.
+func Do[T any](
+	ctx context.Context,
+	s *Scheduler,
+	tenant string,
+	priority Priority,
+	fn func(context.Context) (*T, error),
+	opts ...backoff.Option,
+) (*T, error) {
+	// attempt is set by the hook before each call of the wrapped fn, so
+	// every call of Do tracks its own attempts.
+	attempt := 0
+	opts = append(opts[:len(opts):len(opts)], backoff.WithHooks(backoff.Hooks{
+		BeforeAttempt: func(n int) {
+			attempt = n
+		},
+	}))
+
+	return backoff.Do(ctx, func(ctx context.Context) (*T, error) {
+		if attempt == 0 {
+			return fn(ctx)
+		}
+
+		release, err := s.Acquire(ctx, tenant, priority)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return fn(ctx)
+	}, opts...)
+}
+
+func (s *Scheduler) releaser(tenant string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.release(tenant)
+		})
+	}
+}
+
+func (s *Scheduler) release(tenant string) {
+	s.running--
+	s.tenants[tenant]--
+	if s.tenants[tenant] == 0 {
+		delete(s.tenants, tenant)
+	}
+	s.dispatch()
+}
+
+// enqueue inserts w after every waiter of the same or higher priority.
+func (s *Scheduler) enqueue(w *waiter) {
+	i := len(s.waiting)
+	for i > 0 && s.waiting[i-1].priority < w.priority {
+		i--
+	}
+	s.waiting = append(s.waiting, nil)
+	copy(s.waiting[i+1:], s.waiting[i:])
+	s.waiting[i] = w
+}
+
+func (s *Scheduler) remove(w *waiter) {
+	for i, other := range s.waiting {
+		if other == w {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch grants slots to waiters in order while there is capacity. Waiters
+// whose tenant is at its limit are passed over rather than blocking the
+// waiters behind them.
+func (s *Scheduler) dispatch() {
+	for i := 0; i < len(s.waiting); {
+		if s.limit > 0 && s.running >= s.limit {
+			return
+		}
+
+		w := s.waiting[i]
+		limit, ok := s.tenantLimits[w.tenant]
+		if !ok {
+			limit = s.tenantLimit
+		}
+		if limit > 0 && s.tenants[w.tenant] >= limit {
+			i++
+			continue
+		}
+
+		s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+		s.running++
+		s.tenants[w.tenant]++
+		close(w.ready)
+	}
+}
@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waiting blocks until s has n waiters.
+func waiting(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		got := len(s.waiting)
+		s.mu.Unlock()
+		if got == n {
+			return
+		}
+	}
+	t.Fatalf("never had %d waiters", n)
+}
+
+func TestPriorityOrder(t *testing.T) {
+	s := New(1, 0)
+	release, err := s.Acquire(context.Background(), "t", Normal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, w := range []struct {
+		name     string
+		priority Priority
+	}{
+		{"low", Low},
+		{"normal 1", Normal},
+		{"high", High},
+		{"normal 2", Normal},
+	} {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), "t", w.priority)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, w.name)
+			mu.Unlock()
+			release()
+		}()
+		// Start waiting in turn, so that equal priorities have an order.
+		waiting(t, s, i+1)
+	}
+
+	release()
+	wg.Wait()
+
+	if got := fmt.Sprint(order); got != "[high normal 1 normal 2 low]" {
+		t.Errorf("granted in order %s, want [high normal 1 normal 2 low]", got)
+	}
+}
+
+func TestTenantLimit(t *testing.T) {
+	s := New(0, 1)
+	if _, err := s.Acquire(context.Background(), "a", Normal); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, "a", Normal); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire past tenant limit = %v, want context.DeadlineExceeded", err)
+	}
+
+	granted := make(chan error)
+	go func() {
+		_, err := s.Acquire(context.Background(), "a", High)
+		granted <- err
+	}()
+	waiting(t, s, 1)
+
+	// A tenant at its limit does not hold up other tenants behind it.
+	if _, err := s.Acquire(context.Background(), "b", Low); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetTenantLimit("a", 2)
+	select {
+	case err := <-granted:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("raising the tenant limit did not grant the waiting slot")
+	}
+}
+
+func TestGlobalLimit(t *testing.T) {
+	s := New(2, 0)
+	for _, tenant := range []string{"a", "b"} {
+		if _, err := s.Acquire(context.Background(), tenant, Normal); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, "c", High); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire past global limit = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestCancelWhileWaiting(t *testing.T) {
+	s := New(1, 0)
+	if _, err := s.Acquire(context.Background(), "a", Normal); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.Acquire(ctx, "b", Normal)
+		done <- err
+	}()
+	waiting(t, s, 1)
+
+	// Cancel and free the slot together, so that the waiter may see both the
+	// grant and the cancellation. Either way it must not keep the slot.
+	s.mu.Lock()
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	s.release("a")
+	s.mu.Unlock()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire = %v, want context.Canceled", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != 0 || len(s.tenants) != 0 || len(s.waiting) != 0 {
+		t.Errorf("after cancellation running = %d, tenants = %v, waiting = %d, want all empty", s.running, s.tenants, len(s.waiting))
+	}
+}
@@ -0,0 +1,247 @@
+// Package sim simulates a fleet of clients retrying against a recovering
+// server, to compare how retry policies behave at scale without running them.
+//
+// The simulation is discrete-event: time only advances between attempts, so
+// hours of simulated time for thousands of clients run in well under a second.
+package sim
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// Server models the server the clients retry against.
+type Server struct {
+	// Capacity is how many requests per second the server can serve once it
+	// has fully recovered. Requests beyond it fail.
+	Capacity float64
+	// RecoverAt is when the server starts to recover. Every request before it
+	// fails.
+	RecoverAt time.Duration
+	// RampUp is how long capacity takes to grow linearly from 0 to Capacity
+	// after RecoverAt. If 0, full capacity is restored at once.
+	RampUp time.Duration
+}
+
+// capacity returns the server's capacity in requests per second at t.
+func (s Server) capacity(t time.Duration) float64 {
+	switch {
+	case t < s.RecoverAt:
+		return 0
+	case s.RampUp <= 0 || t >= s.RecoverAt+s.RampUp:
+		return s.Capacity
+	default:
+		return s.Capacity * float64(t-s.RecoverAt) / float64(s.RampUp)
+	}
+}
+
+// Config describes a simulation.
+type Config struct {
+	// Clients is the number of clients.
+	Clients int
+	// Policy is the retry policy used by every client. Its LogFailure is not
+	// called.
+	Policy backoff.Policy
+	// Server is the server being retried against.
+	Server Server
+	// Spread is the window over which clients start, uniformly at random.
+	// If 0, every client starts at the same moment.
+	Spread time.Duration
+	// Step is the resolution of the simulation; requests arriving within the
+	// same step compete for that step's capacity. Defaults to 100ms.
+	Step time.Duration
+	// Duration is how much time to simulate. Clients still retrying at the
+	// end are reported as unfinished. Defaults to 1 hour.
+	Duration time.Duration
+	// Seed determines client start times and which requests are served when
+	// there are more than the server can take. Curves using backoff.Jitter
+	// draw from the global random source and are not affected by it.
+	Seed int64
+}
+
+// Sample is the load on the server during one step.
+type Sample struct {
+	// Time is the start of the step.
+	Time time.Duration
+	// Requests is how many requests arrived.
+	Requests int
+	// Served is how many of them succeeded.
+	Served int
+}
+
+// Report is the result of a simulation.
+type Report struct {
+	// Load has a sample for every step in which requests arrived.
+	Load []Sample
+	// Succeeded is how many clients eventually succeeded.
+	Succeeded int
+	// Failed is how many clients ran out of attempts.
+	Failed int
+	// Unfinished is how many clients were still retrying at the end.
+	Unfinished int
+	// Latencies are the times from start to success of each client which
+	// succeeded, in increasing order.
+	Latencies []time.Duration
+	// Attempts is the total number of requests made.
+	Attempts int
+}
+
+// Percentile returns the p-th percentile, from 0 to 100, of the successful
+// clients' latencies, or 0 if none succeeded.
+func (r Report) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(r.Latencies)-1))
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.Latencies) {
+		i = len(r.Latencies) - 1
+	}
+	return r.Latencies[i]
+}
+
+// PeakLoad returns the most requests which arrived in a single step.
+func (r Report) PeakLoad() int {
+	peak := 0
+	for _, s := range r.Load {
+		if s.Requests > peak {
+			peak = s.Requests
+		}
+	}
+	return peak
+}
+
+// Run simulates conf and reports the load on the server and the outcome for
+// the clients.
+func Run(conf Config) Report {
+	step := conf.Step
+	if step <= 0 {
+		step = 100 * time.Millisecond
+	}
+	duration := conf.Duration
+	if duration <= 0 {
+		duration = time.Hour
+	}
+
+	var report Report
+	if conf.Policy.Curve == nil {
+		report.Failed = conf.Clients
+		return report
+	}
+
+	rng := rand.New(rand.NewSource(conf.Seed))
+	queue := &eventQueue{}
+
+	for i := 0; i < conf.Clients; i++ {
+		var start time.Duration
+		if conf.Spread > 0 {
+			start = time.Duration(rng.Int63n(int64(conf.Spread)))
+		}
+		// Like Backoff, clients wait for the curve's first value before
+		// their first attempt.
+		heap.Push(queue, event{
+			at:    start + conf.Policy.Delay(0),
+			start: start,
+		})
+	}
+
+	// Capacity left over from fractions of a request carries into the next
+	// step, so low capacities are not rounded down to nothing.
+	carry := 0.0
+	var due []event
+
+	for queue.Len() > 0 {
+		now := (*queue)[0].at.Truncate(step)
+		if now >= duration {
+			break
+		}
+		end := now + step
+
+		due = due[:0]
+		for queue.Len() > 0 && (*queue)[0].at < end {
+			due = append(due, heap.Pop(queue).(event))
+		}
+
+		capacity := conf.Server.capacity(now)*step.Seconds() + carry
+		served := int(capacity)
+		carry = capacity - float64(served)
+		if served > len(due) {
+			served = len(due)
+			carry = 0
+		}
+
+		rng.Shuffle(len(due), func(i, j int) {
+			due[i], due[j] = due[j], due[i]
+		})
+
+		report.Load = append(report.Load, Sample{Time: now, Requests: len(due), Served: served})
+		report.Attempts += len(due)
+
+		for i, e := range due {
+			if i < served {
+				report.Succeeded++
+				report.Latencies = append(report.Latencies, e.at-e.start)
+				continue
+			}
+
+			e.attempt++
+			if conf.Policy.MaxAttempts != 0 && e.attempt >= conf.Policy.MaxAttempts {
+				report.Failed++
+				continue
+			}
+			e.at += conf.Policy.Delay(e.attempt)
+			// Attempts never land in a step that has already been simulated.
+			if e.at < end {
+				e.at = end
+			}
+			heap.Push(queue, e)
+		}
+	}
+
+	report.Unfinished = queue.Len()
+	sort.Slice(report.Latencies, func(i, j int) bool {
+		return report.Latencies[i] < report.Latencies[j]
+	})
+	return report
+}
+
+// Compare runs the same simulation once for each of the named policies.
+func Compare(conf Config, policies map[string]backoff.Policy) map[string]Report {
+	reports := make(map[string]Report, len(policies))
+	for name, policy := range policies {
+		c := conf
+		c.Policy = policy
+		reports[name] = Run(c)
+	}
+	return reports
+}
+
+// event is a client's next attempt.
+type event struct {
+	at      time.Duration
+	start   time.Duration
+	attempt int
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int           { return len(q) }
+func (q eventQueue) Less(i, j int) bool { return q[i].at < q[j].at }
+func (q eventQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) {
+	*q = append(*q, x.(event))
+}
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
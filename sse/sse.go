@@ -0,0 +1,330 @@
+// Package sse consumes Server-Sent Events streams, reconnecting with backoff
+// when the connection drops.
+//
+// Reconnections resume from the last received event by sending its ID in the
+// Last-Event-ID header, and wait at least as long as the server asked for in
+// its most recent retry field.
+package sse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// ErrNoContent is returned when the server responds with 204 No Content,
+// which tells clients to stop reconnecting.
+var ErrNoContent = errors.New("sse: server asked client to stop reconnecting")
+
+// DefaultHealthyAfter is the default for Client.HealthyAfter.
+const DefaultHealthyAfter = 30 * time.Second
+
+// Event is a single event from the stream.
+type Event struct {
+	// ID is the event's id field, or the last ID seen if it had none.
+	ID string
+	// Type is the event field, or "message" if it had none.
+	Type string
+	// Data is the event's data fields joined by newlines.
+	Data string
+}
+
+// Client connects to an event stream.
+type Client struct {
+	// URL is the address of the stream.
+	URL string
+	// HTTPClient is used to connect. If nil, http.DefaultClient is used. It
+	// should not have a Timeout, as that would end long-lived streams.
+	HTTPClient *http.Client
+	// Header holds extra headers to send when connecting.
+	Header http.Header
+	// Policy is used to retry connecting. Its attempts start over once a
+	// connection has delivered an event or stayed up for HealthyAfter;
+	// connections dropped before then count as failed attempts, so
+	// MaxAttempts limits consecutive failures.
+	Policy backoff.Policy
+	// HealthyAfter is how long a connection which delivers no events must
+	// stay up for the policy's attempts to start over. Defaults to
+	// DefaultHealthyAfter.
+	HealthyAfter time.Duration
+	// LastEventID, if set, is sent when first connecting to resume an earlier
+	// stream.
+	LastEventID string
+}
+
+// Subscription delivers events from a stream until it ends.
+type Subscription struct {
+	events chan Event
+	done   chan struct{}
+	err    error
+
+	mu          sync.Mutex
+	lastEventID string
+	retry       time.Duration
+}
+
+// Subscribe connects to the stream and delivers its events on the returned
+// subscription, reconnecting as needed until ctx is done or the policy gives
+// up.
+func (c *Client) Subscribe(ctx context.Context) *Subscription {
+	s := &Subscription{
+		events:      make(chan Event),
+		done:        make(chan struct{}),
+		lastEventID: c.LastEventID,
+	}
+	go s.run(ctx, c)
+	return s
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription ends.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns why the subscription ended. It blocks until the events channel
+// is closed.
+func (s *Subscription) Err() error {
+	<-s.done
+	return s.err
+}
+
+// LastEventID returns the ID of the last event received, which can be used as
+// Client.LastEventID to resume later.
+func (s *Subscription) LastEventID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastEventID
+}
+
+func (s *Subscription) run(ctx context.Context, c *Client) {
+	defer close(s.done)
+	defer close(s.events)
+
+	// attempts counts connection attempts since the stream was last healthy,
+	// and drops the errors which ended unhealthy connections, so that a
+	// server which accepts connections and closes them straight away is
+	// backed off from like one which refuses them.
+	attempts := 0
+	var drops []error
+
+	for {
+		policy, ok := c.policy(attempts)
+		if !ok {
+			s.err = &backoff.RetryError{Errors: drops}
+			return
+		}
+
+		var permanent error
+		connectCtx, stop := context.WithCancel(ctx)
+		resp, errs := backoff.Retry(connectCtx, policy, func() (*http.Response, error) {
+			attempts++
+			resp, err := c.connect(ctx, s.LastEventID())
+			if errors.Is(err, ErrNoContent) {
+				permanent = err
+				stop()
+			}
+			return resp, err
+		})
+		stop()
+
+		if resp == nil {
+			switch {
+			case permanent != nil:
+				s.err = permanent
+			case ctx.Err() != nil:
+				s.err = ctx.Err()
+			default:
+				s.err = &backoff.RetryError{Errors: append(drops, errs...)}
+			}
+			return
+		}
+
+		connected := time.Now()
+		delivered, err := s.read(ctx, resp.Body)
+		resp.Body.Close()
+		if ctx.Err() != nil {
+			s.err = ctx.Err()
+			return
+		}
+		if c.Policy.LogFailure != nil && err != nil {
+			c.Policy.LogFailure(err)
+		}
+
+		if delivered || time.Since(connected) >= c.healthyAfter() {
+			attempts = 0
+			drops = nil
+		} else {
+			drops = append(drops, err)
+		}
+
+		s.mu.Lock()
+		retry := s.retry
+		s.mu.Unlock()
+		if retry > 0 {
+			timer := time.NewTimer(retry)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				s.err = ctx.Err()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// policy returns the client's policy carried on from `attempts` connection
+// attempts already made, or false if it has none left.
+func (c *Client) policy(attempts int) (backoff.Policy, bool) {
+	p := c.Policy
+	if attempts == 0 {
+		return p, true
+	}
+	if p.MaxAttempts > 0 {
+		if attempts >= p.MaxAttempts {
+			return p, false
+		}
+		p.MaxAttempts -= attempts
+	}
+	if curve := p.Curve; curve != nil {
+		p.Curve = func(x float64) float64 {
+			return curve(x + float64(attempts))
+		}
+	}
+	return p, true
+}
+
+func (c *Client) healthyAfter() time.Duration {
+	if c.HealthyAfter <= 0 {
+		return DefaultHealthyAfter
+	}
+	return c.HealthyAfter
+}
+
+func (c *Client) connect(ctx context.Context, lastEventID string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		resp.Body.Close()
+		return nil, ErrNoContent
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, fmt.Errorf("sse: unexpected status %s", resp.Status)
+	case !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+		resp.Body.Close()
+		return nil, fmt.Errorf("sse: unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	return resp, nil
+}
+
+// read parses events from body and delivers them until the stream ends,
+// reporting whether any event was delivered.
+func (s *Subscription) read(ctx context.Context, body io.Reader) (delivered bool, err error) {
+	reader := bufio.NewReader(body)
+
+	var data strings.Builder
+	eventType := ""
+	hasData := false
+	// id is only committed as the last event ID once its event is complete,
+	// so that an event cut off by a dropped connection is sent again.
+	id := s.LastEventID()
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Streams are not expected to end, so EOF is treated as a
+			// dropped connection. Any partial event is discarded.
+			if err == io.EOF {
+				return delivered, io.ErrUnexpectedEOF
+			}
+			return delivered, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			s.mu.Lock()
+			s.lastEventID = id
+			s.mu.Unlock()
+
+			if hasData {
+				event := Event{
+					ID:   id,
+					Type: eventType,
+					Data: data.String(),
+				}
+				if event.Type == "" {
+					event.Type = "message"
+				}
+				select {
+				case s.events <- event:
+					delivered = true
+				case <-ctx.Done():
+					return delivered, ctx.Err()
+				}
+			}
+			data.Reset()
+			eventType = ""
+			hasData = false
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "":
+			// Comment.
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "event":
+			eventType = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				id = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				s.mu.Lock()
+				s.retry = time.Duration(ms) * time.Millisecond
+				s.mu.Unlock()
+			}
+		}
+	}
+}
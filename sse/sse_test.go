@@ -0,0 +1,180 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// conn is a request seen by a test server.
+type conn struct {
+	lastEventID string
+	at          time.Time
+}
+
+// server serves the given bodies, one per connection, as event streams, and
+// responds with 204 No Content once they run out.
+type server struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	conns []conn
+}
+
+func newServer(t *testing.T, bodies ...string) *server {
+	s := &server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		n := len(s.conns)
+		s.conns = append(s.conns, conn{lastEventID: r.Header.Get("Last-Event-ID"), at: time.Now()})
+		s.mu.Unlock()
+
+		if n >= len(bodies) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, bodies[n])
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *server) seen() []conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]conn(nil), s.conns...)
+}
+
+func fastPolicy(attempts int) backoff.Policy {
+	return backoff.Policy{
+		Curve:            func(float64) float64 { return 0.01 },
+		MaxAttempts:      attempts,
+		FractionalDelays: true,
+	}
+}
+
+// collect subscribes with c and returns every event and the subscription's
+// error.
+func collect(t *testing.T, c *Client) ([]Event, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub := c.Subscribe(ctx)
+	var events []Event
+	for e := range sub.Events() {
+		events = append(events, e)
+	}
+	return events, sub.Err()
+}
+
+func TestResume(t *testing.T) {
+	s := newServer(t,
+		"id: 1\ndata: a\n\n",
+		"id: 2\nevent: update\ndata: b\ndata: c\n\n",
+	)
+
+	c := &Client{URL: s.URL, Policy: fastPolicy(3), LastEventID: "0"}
+	events, err := collect(t, c)
+	if !errors.Is(err, ErrNoContent) {
+		t.Fatalf("Err() = %v, want ErrNoContent", err)
+	}
+
+	want := []Event{
+		{ID: "1", Type: "message", Data: "a"},
+		{ID: "2", Type: "update", Data: "b\nc"},
+	}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	conns := s.seen()
+	var ids []string
+	for _, c := range conns {
+		ids = append(ids, c.lastEventID)
+	}
+	if fmt.Sprint(ids) != "[0 1 2]" {
+		t.Errorf("Last-Event-ID headers = %q, want [0 1 2]", ids)
+	}
+}
+
+func TestRetryField(t *testing.T) {
+	s := newServer(t, "retry: 300\ndata: a\n\n")
+
+	c := &Client{URL: s.URL, Policy: fastPolicy(3)}
+	if _, err := collect(t, c); !errors.Is(err, ErrNoContent) {
+		t.Fatalf("Err() = %v, want ErrNoContent", err)
+	}
+
+	conns := s.seen()
+	if len(conns) != 2 {
+		t.Fatalf("got %d connections, want 2", len(conns))
+	}
+	if gap := conns[1].at.Sub(conns[0].at); gap < 300*time.Millisecond {
+		t.Errorf("reconnected after %s, want at least 300ms", gap)
+	}
+}
+
+func TestNoContent(t *testing.T) {
+	s := newServer(t)
+
+	c := &Client{URL: s.URL, Policy: fastPolicy(0)}
+	events, err := collect(t, c)
+	if !errors.Is(err, ErrNoContent) {
+		t.Fatalf("Err() = %v, want ErrNoContent", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %v, want none", events)
+	}
+	if n := len(s.seen()); n != 1 {
+		t.Errorf("got %d connections, want 1", n)
+	}
+}
+
+func TestDropMidEvent(t *testing.T) {
+	s := newServer(t,
+		"id: 1\ndata: a\n\nid: 2\ndata: b",
+		"id: 2\ndata: b\n\n",
+	)
+
+	c := &Client{URL: s.URL, Policy: fastPolicy(3)}
+	events, err := collect(t, c)
+	if !errors.Is(err, ErrNoContent) {
+		t.Fatalf("Err() = %v, want ErrNoContent", err)
+	}
+
+	want := []Event{
+		{ID: "1", Type: "message", Data: "a"},
+		{ID: "2", Type: "message", Data: "b"},
+	}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	if conns := s.seen(); len(conns) < 2 || conns[1].lastEventID != "1" {
+		t.Errorf("resumed with %v, want Last-Event-ID 1", conns)
+	}
+}
+
+func TestUnhealthyStream(t *testing.T) {
+	// Every connection is accepted and closed without an event.
+	s := newServer(t, ": hello\n\n", ": hello\n\n", ": hello\n\n", ": hello\n\n")
+
+	c := &Client{URL: s.URL, Policy: fastPolicy(3)}
+	_, err := collect(t, c)
+
+	var retryErr *backoff.RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("Err() = %v, want a RetryError", err)
+	}
+	if n := len(s.seen()); n != 3 {
+		t.Errorf("got %d connections, want 3", n)
+	}
+}
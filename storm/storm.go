@@ -0,0 +1,242 @@
+// Package storm detects retry storms, where retries come to dominate the
+// traffic of an operation.
+//
+// A Detector counts first attempts and retries per operation over a sliding
+// window. When retries per first attempt cross a threshold it reports a
+// storm, and it only reports the storm as over once the ratio has fallen to a
+// lower threshold, so that a ratio hovering around the threshold does not
+// flap. While a storm lasts, the Detector can tighten the retry policy of
+// calls made through it with a backoff.Override.
+package storm
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// Detector tracks the retry ratio of operations. Its fields must not be
+// changed once it is in use.
+type Detector struct {
+	// Window is how far back attempts are counted. Defaults to 1 minute.
+	Window time.Duration
+	// Buckets is how many slices the window is divided into; more buckets
+	// make the window slide more smoothly. Defaults to 10.
+	Buckets int
+	// Threshold is the number of retries per first attempt at which a storm
+	// starts. If 0 or less, storms are never reported.
+	Threshold float64
+	// Clear is the ratio at or below which a storm ends. Defaults to half of
+	// Threshold.
+	Clear float64
+	// MinAttempts is how many first attempts must be in the window before a
+	// storm can start, so that a handful of calls cannot trigger one.
+	MinAttempts int
+	// OnStorm, if not nil, is called when a storm starts.
+	OnStorm func(operation string, ratio float64)
+	// OnClear, if not nil, is called when a storm ends.
+	OnClear func(operation string, ratio float64)
+	// Tighten, if not nil, is attached by Context to calls of an operation
+	// while it is storming.
+	Tighten *backoff.Override
+
+	mu  sync.Mutex
+	ops map[string]*operation
+}
+
+type operation struct {
+	buckets  []bucket
+	storming bool
+	// timer re-evaluates the operation while it is storming, so that the
+	// storm is seen to end even if its traffic stops.
+	timer *time.Timer
+}
+
+type bucket struct {
+	// epoch is the index of the bucket-sized slice of time it counts.
+	epoch   int64
+	first   int
+	retries int
+}
+
+// Hooks returns hooks, suitable for backoff.WithHooks, which record the
+// attempts of `op`.
+func (d *Detector) Hooks(op string) backoff.Hooks {
+	return backoff.Hooks{
+		BeforeAttempt: func(attempt int) {
+			d.Record(op, attempt > 0)
+		},
+	}
+}
+
+// Record counts an attempt of `op`, which is a retry if `retry` is true.
+func (d *Detector) Record(op string, retry bool) {
+	d.mu.Lock()
+	o := d.operation(op)
+	b := d.bucket(o, time.Now())
+	if retry {
+		b.retries++
+	} else {
+		b.first++
+	}
+	notify := d.evaluate(op, o)
+	d.mu.Unlock()
+
+	notify()
+}
+
+// Ratio returns the retries per first attempt of `op` over the window. It is
+// +Inf if there were retries but no first attempts.
+func (d *Detector) Ratio(op string) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	o, ok := d.ops[op]
+	if !ok {
+		return 0
+	}
+	first, retries := d.totals(o, time.Now())
+	return ratio(first, retries)
+}
+
+// Storming reports whether `op` is in a storm.
+func (d *Detector) Storming(op string) bool {
+	d.mu.Lock()
+	o, ok := d.ops[op]
+	if !ok {
+		d.mu.Unlock()
+		return false
+	}
+	notify := d.evaluate(op, o)
+	storming := o.storming
+	d.mu.Unlock()
+
+	notify()
+	return storming
+}
+
+// Context returns ctx with the Tighten override attached if `op` is storming,
+// so that calls made with it retry less.
+func (d *Detector) Context(ctx context.Context, op string) context.Context {
+	if d.Tighten == nil || !d.Storming(op) {
+		return ctx
+	}
+	return backoff.OverrideContext(ctx, *d.Tighten)
+}
+
+// evaluate updates whether o is storming, returning a function which makes
+// the matching callback, to be called once the lock is released.
+func (d *Detector) evaluate(op string, o *operation) (notify func()) {
+	first, retries := d.totals(o, time.Now())
+	r := ratio(first, retries)
+
+	clear := d.Clear
+	if clear == 0 {
+		clear = d.Threshold / 2
+	}
+
+	switch {
+	case !o.storming && d.Threshold > 0 && first >= d.MinAttempts && retries > 0 && r >= d.Threshold:
+		o.storming = true
+		d.watch(op, o)
+		if d.OnStorm != nil {
+			return func() { d.OnStorm(op, r) }
+		}
+	case o.storming && r <= clear:
+		o.storming = false
+		o.timer.Stop()
+		if d.OnClear != nil {
+			return func() { d.OnClear(op, r) }
+		}
+	}
+	return func() {}
+}
+
+// watch re-evaluates o every bucket while it is storming, as attempts age out
+// of the window.
+func (d *Detector) watch(op string, o *operation) {
+	var timer *time.Timer
+	timer = time.AfterFunc(d.width(), func() {
+		d.mu.Lock()
+		if o.timer != timer {
+			// A later storm has its own timer.
+			d.mu.Unlock()
+			return
+		}
+		notify := d.evaluate(op, o)
+		if o.storming {
+			timer.Reset(d.width())
+		}
+		d.mu.Unlock()
+
+		notify()
+	})
+	o.timer = timer
+}
+
+func (d *Detector) operation(op string) *operation {
+	if d.ops == nil {
+		d.ops = map[string]*operation{}
+	}
+	o, ok := d.ops[op]
+	if !ok {
+		o = &operation{buckets: make([]bucket, d.buckets())}
+		d.ops[op] = o
+	}
+	return o
+}
+
+// bucket returns the bucket counting `now`, clearing it if it last counted
+// an earlier slice of time.
+func (d *Detector) bucket(o *operation, now time.Time) *bucket {
+	epoch := now.UnixNano() / int64(d.width())
+	b := &o.buckets[epoch%int64(len(o.buckets))]
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+	return b
+}
+
+// totals sums the buckets which fall within the window ending at `now`.
+func (d *Detector) totals(o *operation, now time.Time) (first, retries int) {
+	epoch := now.UnixNano() / int64(d.width())
+	for _, b := range o.buckets {
+		if epoch-b.epoch < int64(len(o.buckets)) {
+			first += b.first
+			retries += b.retries
+		}
+	}
+	return first, retries
+}
+
+func (d *Detector) width() time.Duration {
+	window := d.Window
+	if window <= 0 {
+		window = time.Minute
+	}
+	w := window / time.Duration(d.buckets())
+	if w <= 0 {
+		w = 1
+	}
+	return w
+}
+
+func (d *Detector) buckets() int {
+	if d.Buckets <= 0 {
+		return 10
+	}
+	return d.Buckets
+}
+
+func ratio(first, retries int) float64 {
+	if first == 0 {
+		if retries == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return float64(retries) / float64(first)
+}
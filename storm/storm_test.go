@@ -0,0 +1,109 @@
+package storm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+func TestDisabled(t *testing.T) {
+	d := &Detector{}
+	d.Record("op", false)
+	for i := 0; i < 10; i++ {
+		d.Record("op", true)
+	}
+	if d.Storming("op") {
+		t.Error("storming with no threshold")
+	}
+}
+
+func TestMinAttempts(t *testing.T) {
+	d := &Detector{Threshold: 1, MinAttempts: 3}
+	d.Record("op", false)
+	d.Record("op", true)
+	d.Record("op", true)
+	if d.Storming("op") {
+		t.Error("storming with fewer first attempts than MinAttempts")
+	}
+}
+
+func TestHysteresis(t *testing.T) {
+	var events []string
+	d := &Detector{
+		Threshold:   2,
+		Clear:       1,
+		MinAttempts: 1,
+		OnStorm:     func(op string, _ float64) { events = append(events, "storm") },
+		OnClear:     func(op string, _ float64) { events = append(events, "clear") },
+	}
+
+	steps := []struct {
+		retry    bool
+		storming bool
+	}{
+		{false, false}, // 0
+		{true, false},  // 1
+		{true, true},   // 2, reaching the threshold
+		{true, true},   // 3
+		{false, true},  // 1.5, between the thresholds
+		{false, false}, // 1, reaching the clear ratio
+		{true, false},  // 1.33, between the thresholds
+	}
+	for i, step := range steps {
+		d.Record("op", step.retry)
+		if got := d.Storming("op"); got != step.storming {
+			t.Fatalf("step %d: Storming = %v at ratio %v, want %v", i, got, d.Ratio("op"), step.storming)
+		}
+	}
+	if len(events) != 2 || events[0] != "storm" || events[1] != "clear" {
+		t.Errorf("events = %v, want [storm clear]", events)
+	}
+	if d.Storming("other") {
+		t.Error("unrelated operation storming")
+	}
+}
+
+func TestClearsWithoutTraffic(t *testing.T) {
+	cleared := make(chan float64, 1)
+	d := &Detector{
+		Window:      100 * time.Millisecond,
+		Buckets:     2,
+		Threshold:   1,
+		MinAttempts: 1,
+		OnClear:     func(_ string, ratio float64) { cleared <- ratio },
+	}
+	d.Record("op", false)
+	d.Record("op", true)
+	if !d.Storming("op") {
+		t.Fatal("not storming")
+	}
+
+	// Nothing calls the detector again, so only its timer can end the storm.
+	select {
+	case ratio := <-cleared:
+		if ratio != 0 {
+			t.Errorf("cleared at ratio %v, want 0 once the window is empty", ratio)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("storm did not clear once its attempts left the window")
+	}
+}
+
+func TestContext(t *testing.T) {
+	d := &Detector{Threshold: 1, MinAttempts: 1, Tighten: &backoff.Override{MaxAttempts: 1}}
+
+	if _, ok := backoff.OverrideFromContext(d.Context(context.Background(), "op")); ok {
+		t.Error("override attached without a storm")
+	}
+
+	hooks := d.Hooks("op")
+	hooks.BeforeAttempt(0)
+	hooks.BeforeAttempt(1)
+
+	o, ok := backoff.OverrideFromContext(d.Context(context.Background(), "op"))
+	if !ok || o.MaxAttempts != 1 {
+		t.Errorf("override during storm = %v, %v, want MaxAttempts 1", o, ok)
+	}
+}
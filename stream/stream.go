@@ -0,0 +1,110 @@
+// Package stream consumes server-streaming RPCs, reopening them with backoff
+// from the last processed position when they break.
+//
+// It is written against a minimal Stream interface which generated gRPC
+// client streams already satisfy, so it does not depend on gRPC itself.
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/zaptross/backoff"
+)
+
+// Stream is a stream of messages. gRPC client streams implement it, with M
+// being a pointer to the response message.
+type Stream[M any] interface {
+	// Recv returns the next message, or io.EOF once the stream has finished.
+	Recv() (M, error)
+}
+
+// Opener opens a stream starting after `resumeToken`. An empty token means
+// from the beginning.
+type Opener[M any] func(ctx context.Context, resumeToken string) (Stream[M], error)
+
+// Options configures Consume.
+type Options struct {
+	// Policy is used to retry opening and reading the stream. Attempts start
+	// over whenever a reopened stream delivers a message, so MaxAttempts
+	// limits consecutive failures without progress.
+	Policy backoff.Policy
+	// ResumeToken is where to start from. If empty, the stream is consumed
+	// from the beginning.
+	ResumeToken string
+}
+
+// progress is what an attempt returns to stop the current retry loop.
+type progress struct {
+	// finished is true once the stream returned io.EOF.
+	finished bool
+}
+
+// Consume opens the stream and passes each message to handle, reopening the
+// stream from the last handled message whenever it breaks.
+//
+// A message is acknowledged once handle returns nil, and its token, from
+// `token`, is used to resume. If handle returns an error, consuming stops and
+// that error is returned along with the last acknowledged token, so that the
+// caller can resume later.
+func Consume[M any](
+	ctx context.Context,
+	open Opener[M],
+	token func(M) string,
+	handle func(M) error,
+	opts Options,
+) (lastToken string, err error) {
+	lastToken = opts.ResumeToken
+
+	for {
+		var handleErr error
+		attemptCtx, stop := context.WithCancel(ctx)
+
+		res, errs := backoff.Retry(attemptCtx, opts.Policy, func() (*progress, error) {
+			s, err := open(attemptCtx, lastToken)
+			if err != nil {
+				return nil, err
+			}
+
+			progressed := false
+			for {
+				msg, err := s.Recv()
+				if errors.Is(err, io.EOF) {
+					return &progress{finished: true}, nil
+				}
+				if err != nil {
+					if progressed {
+						// Break out so that the next reopen starts the
+						// policy over, reporting the failure on the way.
+						if opts.Policy.LogFailure != nil {
+							opts.Policy.LogFailure(err)
+						}
+						return &progress{}, nil
+					}
+					return nil, err
+				}
+
+				if err := handle(msg); err != nil {
+					handleErr = err
+					stop()
+					return nil, err
+				}
+				lastToken = token(msg)
+				progressed = true
+			}
+		})
+		stop()
+
+		switch {
+		case handleErr != nil:
+			return lastToken, handleErr
+		case res == nil && ctx.Err() != nil:
+			return lastToken, ctx.Err()
+		case res == nil:
+			return lastToken, &backoff.RetryError{Errors: errs}
+		case res.finished:
+			return lastToken, nil
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package supervise keeps a long-running command alive, restarting it with
+// backoff whenever it exits.
+//
+// The delay between restarts follows a curve which starts over once the
+// command has stayed up long enough to be considered healthy, so a daemon
+// which crashes once a day is restarted promptly while one which crashes on
+// start is not restarted in a tight loop.
+package supervise
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+// ErrGaveUp is returned when the command has been restarted MaxRestarts times
+// without a healthy run.
+var ErrGaveUp = errors.New("supervise: too many restarts")
+
+// NoRestarts is a value for Config.MaxRestarts which gives up as soon as the
+// command first exits.
+const NoRestarts = -1
+
+// Event types written to the log.
+const (
+	EventStart   = "start"
+	EventExit    = "exit"
+	EventRestart = "restart"
+	EventSignal  = "signal"
+	EventStop    = "stop"
+	EventGiveUp  = "give-up"
+)
+
+// Event is a line written to the log.
+type Event struct {
+	Time     time.Time     `json:"time"`
+	Type     string        `json:"type"`
+	PID      int           `json:"pid,omitempty"`
+	ExitCode *int          `json:"exit_code,omitempty"`
+	Uptime   time.Duration `json:"uptime,omitempty"`
+	Delay    time.Duration `json:"delay,omitempty"`
+	Restarts int           `json:"restarts"`
+	Signal   string        `json:"signal,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Config describes what to supervise and how.
+type Config struct {
+	// Command returns a new, unstarted command for each run.
+	Command func() *exec.Cmd
+	// Curve determines how long in seconds to wait before each restart,
+	// counting from 0 after every healthy run.
+	Curve func(float64) float64
+	// MaxRestarts is the number of consecutive restarts after which to give
+	// up. Like the curve, the count starts over after every healthy run, so
+	// only crashes in quick succession use it up. If 0, the command is
+	// restarted indefinitely; use NoRestarts to never restart it.
+	MaxRestarts int
+	// HealthyAfter is how long the command must stay up for the curve to
+	// start over. If 0, the curve never starts over.
+	HealthyAfter time.Duration
+	// Signals are forwarded to the running command.
+	Signals <-chan os.Signal
+	// StopSignals are the signals which, once forwarded, stop the command
+	// from being restarted when it exits. Defaults to SIGINT and SIGTERM.
+	StopSignals []os.Signal
+	// StopTimeout is how long to wait for the command to exit after
+	// forwarding SIGTERM when ctx is done, before killing it. Defaults to 10
+	// seconds.
+	StopTimeout time.Duration
+	// Log, if not nil, receives an Event as a JSON line for everything the
+	// supervisor does.
+	Log io.Writer
+}
+
+// Run starts the command and restarts it whenever it exits, until ctx is
+// done, a stop signal is forwarded or MaxRestarts is reached.
+//
+// It returns nil if the command exited after a stop signal, ctx's error if
+// ctx was done, or ErrGaveUp.
+func Run(ctx context.Context, conf Config) error {
+	if conf.Command == nil || conf.Curve == nil {
+		return backoff.ErrInvalidConfig
+	}
+	if conf.StopSignals == nil {
+		conf.StopSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	if conf.StopTimeout == 0 {
+		conf.StopTimeout = 10 * time.Second
+	}
+
+	s := &supervisor{conf: conf}
+	// attempt counts restarts since the last healthy run, and restarts
+	// counts every restart.
+	attempt := 0
+
+	for restarts := 0; ; restarts++ {
+		cmd := conf.Command()
+		started := time.Now()
+		if err := cmd.Start(); err != nil {
+			s.log(Event{Type: EventExit, Restarts: restarts, Error: err.Error()})
+		} else {
+			s.log(Event{Type: EventStart, PID: cmd.Process.Pid, Restarts: restarts})
+
+			stop, err := s.wait(ctx, cmd)
+			uptime := time.Since(started)
+			code := cmd.ProcessState.ExitCode()
+			event := Event{Type: EventExit, PID: cmd.Process.Pid, ExitCode: &code, Uptime: uptime, Restarts: restarts}
+			if err != nil {
+				event.Error = err.Error()
+			}
+			s.log(event)
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if stop {
+				s.log(Event{Type: EventStop, Restarts: restarts})
+				return nil
+			}
+			if conf.HealthyAfter > 0 && uptime >= conf.HealthyAfter {
+				attempt = 0
+			}
+		}
+
+		if conf.MaxRestarts != 0 && attempt >= conf.MaxRestarts {
+			s.log(Event{Type: EventGiveUp, Restarts: restarts})
+			return ErrGaveUp
+		}
+
+		delay := backoff.Delay(conf.Curve, attempt)
+		attempt++
+		s.log(Event{Type: EventRestart, Delay: delay, Restarts: restarts + 1})
+
+		if stop := s.sleep(ctx, delay); stop {
+			s.log(Event{Type: EventStop, Restarts: restarts})
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+type supervisor struct {
+	conf Config
+}
+
+// wait waits for cmd to exit, forwarding signals to it. It reports whether a
+// stop signal was forwarded.
+func (s *supervisor) wait(ctx context.Context, cmd *exec.Cmd) (stop bool, err error) {
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	var kill <-chan time.Time
+	cancelled := ctx.Done()
+
+	for {
+		select {
+		case err := <-exited:
+			return stop, err
+		case sig := <-s.conf.Signals:
+			s.log(Event{Type: EventSignal, PID: cmd.Process.Pid, Signal: sig.String()})
+			cmd.Process.Signal(sig)
+			if s.isStop(sig) {
+				stop = true
+			}
+		case <-cancelled:
+			cancelled = nil
+			cmd.Process.Signal(syscall.SIGTERM)
+			kill = time.After(s.conf.StopTimeout)
+		case <-kill:
+			cmd.Process.Kill()
+		}
+	}
+}
+
+// sleep waits out a restart delay, reporting whether a stop signal arrived
+// meanwhile.
+func (s *supervisor) sleep(ctx context.Context, d time.Duration) (stop bool) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		case sig := <-s.conf.Signals:
+			s.log(Event{Type: EventSignal, Signal: sig.String()})
+			if s.isStop(sig) {
+				return true
+			}
+		}
+	}
+}
+
+func (s *supervisor) isStop(sig os.Signal) bool {
+	for _, stop := range s.conf.StopSignals {
+		if sig == stop {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *supervisor) log(e Event) {
+	if s.conf.Log == nil {
+		return
+	}
+	e.Time = time.Now()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.conf.Log.Write(append(line, '\n'))
+}
@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory Store. It is not durable, and is intended for tests
+// and as a reference for real stores.
+type Memory struct {
+	mu         sync.Mutex
+	endpoints  map[string]Endpoint
+	deliveries map[string]Delivery
+}
+
+// NewMemory returns an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		endpoints:  map[string]Endpoint{},
+		deliveries: map[string]Delivery{},
+	}
+}
+
+// Endpoint implements Store.
+func (m *Memory) Endpoint(ctx context.Context, id string) (Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.endpoints[id]
+	if !ok {
+		return Endpoint{}, ErrNotFound
+	}
+	return e, nil
+}
+
+// Endpoints implements Store.
+func (m *Memory) Endpoints(ctx context.Context) ([]Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	endpoints := make([]Endpoint, 0, len(m.endpoints))
+	for _, e := range m.endpoints {
+		endpoints = append(endpoints, e)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].ID < endpoints[j].ID
+	})
+	return endpoints, nil
+}
+
+// SaveEndpoint implements Store.
+func (m *Memory) SaveEndpoint(ctx context.Context, e Endpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if old, ok := m.endpoints[e.ID]; ok && old.Disabled && !e.Disabled {
+		e.FailingSince = time.Time{}
+	}
+	m.endpoints[e.ID] = e
+	return nil
+}
+
+// RecordEndpointFailure implements Store.
+func (m *Memory) RecordEndpointFailure(ctx context.Context, id string, at time.Time, disableAfter time.Duration) (Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.endpoints[id]
+	if !ok {
+		return Endpoint{}, ErrNotFound
+	}
+	if e.FailingSince.IsZero() {
+		e.FailingSince = at
+	}
+	if disableAfter > 0 && at.Sub(e.FailingSince) >= disableAfter {
+		e.Disabled = true
+	}
+	m.endpoints[id] = e
+	return e, nil
+}
+
+// ClearEndpointFailure implements Store.
+func (m *Memory) ClearEndpointFailure(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.endpoints[id]
+	if !ok {
+		return ErrNotFound
+	}
+	e.FailingSince = time.Time{}
+	m.endpoints[id] = e
+	return nil
+}
+
+// Enqueue implements Store.
+func (m *Memory) Enqueue(ctx context.Context, d Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.endpoints[d.EndpointID]; !ok {
+		return ErrNotFound
+	}
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+// Due implements Store.
+func (m *Memory) Due(ctx context.Context, endpointID string, now time.Time, limit int) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []Delivery
+	for _, d := range m.deliveries {
+		if d.EndpointID == endpointID && d.Status == StatusPending && !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// UpdateDelivery implements Store.
+func (m *Memory) UpdateDelivery(ctx context.Context, d Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.deliveries[d.ID]; !ok {
+		return ErrNotFound
+	}
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+// Delivery returns a delivery by ID, for inspecting outcomes in tests.
+func (m *Memory) Delivery(id string) (Delivery, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.deliveries[id]
+	return d, ok
+}
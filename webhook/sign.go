@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned by Verify when a signature does not match.
+var ErrInvalidSignature = errors.New("webhook: invalid signature")
+
+// Sign returns the signature header value for a payload sent at `at`, in the
+// form "t=<unix seconds>,v1=<hex HMAC-SHA256>". The HMAC covers the timestamp
+// and payload joined by a dot, so that signatures cannot be replayed with a
+// different timestamp.
+func Sign(secret []byte, at time.Time, payload []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, mac(secret, ts, payload))
+}
+
+// Verify checks a signature header made by Sign, for use by receivers. It
+// rejects signatures made more than `tolerance` ago; if tolerance is 0, the
+// timestamp is not checked.
+func Verify(secret []byte, header string, payload []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+	if ts == "" || sig == "" {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, payload))) {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 {
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || time.Since(time.Unix(unix, 0)) > tolerance {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+func mac(secret []byte, ts string, payload []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
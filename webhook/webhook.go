@@ -0,0 +1,323 @@
+// Package webhook delivers webhooks at least once, retrying failed deliveries
+// on a backoff curve which may span hours or days.
+//
+// Deliveries and their retry schedule live in a Store, so that they survive
+// restarts. Each endpoint has its own queue, worked by its own goroutine, so a
+// slow or failing endpoint does not hold up the others, and an endpoint which
+// keeps failing for long enough is disabled.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zaptross/backoff"
+)
+
+var (
+	// ErrNotFound is returned by a Store for unknown endpoints.
+	ErrNotFound = errors.New("webhook: not found")
+	// ErrDisabled is returned when sending to a disabled endpoint.
+	ErrDisabled = errors.New("webhook: endpoint disabled")
+)
+
+// Header names set on each delivery.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// Endpoint is a destination for webhooks.
+type Endpoint struct {
+	ID     string
+	URL    string
+	Secret []byte
+	// Disabled endpoints are not delivered to.
+	Disabled bool
+	// FailingSince is when the endpoint started failing, or zero if its last
+	// delivery succeeded.
+	FailingSince time.Time
+}
+
+// Status is the state of a delivery.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+)
+
+// Delivery is a webhook to be sent to an endpoint.
+type Delivery struct {
+	ID         string
+	EndpointID string
+	Payload    []byte
+	Status     Status
+	CreatedAt  time.Time
+	// Attempts is the number of attempts made so far.
+	Attempts int
+	// NextAttempt is when the delivery is next due to be attempted.
+	NextAttempt time.Time
+	LastError   string
+}
+
+// Store persists endpoints and deliveries.
+type Store interface {
+	Endpoint(ctx context.Context, id string) (Endpoint, error)
+	Endpoints(ctx context.Context) ([]Endpoint, error)
+	// SaveEndpoint creates or replaces an endpoint. Saving an enabled
+	// endpoint over a disabled one clears FailingSince, so that a re-enabled
+	// endpoint is not disabled again by its first failure.
+	SaveEndpoint(ctx context.Context, e Endpoint) error
+	// RecordEndpointFailure sets an endpoint's FailingSince to `at` if it is
+	// not already failing, and disables it if it has been failing for at
+	// least `disableAfter`, when that is not 0. It returns the endpoint as
+	// updated. Other fields must be left as they are, as they may have been
+	// changed since the endpoint was read.
+	RecordEndpointFailure(ctx context.Context, id string, at time.Time, disableAfter time.Duration) (Endpoint, error)
+	// ClearEndpointFailure sets an endpoint's FailingSince to zero, leaving
+	// its other fields as they are.
+	ClearEndpointFailure(ctx context.Context, id string) error
+	// Enqueue adds a new delivery.
+	Enqueue(ctx context.Context, d Delivery) error
+	// Due returns up to `limit` pending deliveries for an endpoint whose
+	// NextAttempt is not after `now`, oldest first.
+	Due(ctx context.Context, endpointID string, now time.Time, limit int) ([]Delivery, error)
+	// UpdateDelivery saves the state of an existing delivery.
+	UpdateDelivery(ctx context.Context, d Delivery) error
+}
+
+// Sender delivers webhooks from a Store.
+type Sender struct {
+	Store Store
+	// Client is used to send deliveries. If nil, a client with a 30 second
+	// timeout is used.
+	Client *http.Client
+	// Curve determines how long in seconds to wait before each retry of a
+	// delivery, counting from 0 for the first retry.
+	Curve func(float64) float64
+	// MaxAttempts is the number of attempts after which a delivery is marked
+	// as failed. If 0, deliveries are retried until their endpoint is
+	// disabled.
+	MaxAttempts int
+	// DisableAfter is how long an endpoint may keep failing before it is
+	// disabled. If 0, endpoints are never disabled.
+	DisableAfter time.Duration
+	// PollInterval is how often the Store is checked for due deliveries and
+	// new endpoints. Defaults to 5 seconds.
+	PollInterval time.Duration
+	// LogFailure, if not nil, is called with the error each time a delivery
+	// attempt fails.
+	LogFailure func(error)
+}
+
+// Send queues payload for delivery to an endpoint, to be sent by Run.
+func (s *Sender) Send(ctx context.Context, endpointID string, payload []byte) (Delivery, error) {
+	endpoint, err := s.Store.Endpoint(ctx, endpointID)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if endpoint.Disabled {
+		return Delivery{}, ErrDisabled
+	}
+
+	now := time.Now()
+	d := Delivery{
+		ID:          newID(),
+		EndpointID:  endpointID,
+		Payload:     payload,
+		Status:      StatusPending,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+	return d, s.Store.Enqueue(ctx, d)
+}
+
+// Run delivers due webhooks until ctx is done, running a worker for each
+// enabled endpoint.
+func (s *Sender) Run(ctx context.Context) error {
+	if s.Store == nil || s.Curve == nil {
+		return backoff.ErrInvalidConfig
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	workers := map[string]bool{}
+	defer wg.Wait()
+
+	for {
+		endpoints, err := s.Store.Endpoints(ctx)
+		if err != nil {
+			s.logFailure(err)
+		}
+
+		for _, e := range endpoints {
+			mu.Lock()
+			running := workers[e.ID]
+			if !e.Disabled && !running {
+				workers[e.ID] = true
+			}
+			mu.Unlock()
+			if e.Disabled || running {
+				continue
+			}
+
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				s.work(ctx, id)
+				mu.Lock()
+				delete(workers, id)
+				mu.Unlock()
+			}(e.ID)
+		}
+
+		if !sleep(ctx, s.pollInterval()) {
+			return ctx.Err()
+		}
+	}
+}
+
+// work delivers an endpoint's due deliveries until ctx is done or the
+// endpoint is disabled.
+func (s *Sender) work(ctx context.Context, endpointID string) {
+	for {
+		endpoint, err := s.Store.Endpoint(ctx, endpointID)
+		if err != nil || endpoint.Disabled {
+			return
+		}
+
+		due, err := s.Store.Due(ctx, endpointID, time.Now(), 10)
+		if err != nil {
+			s.logFailure(err)
+		}
+
+		for _, d := range due {
+			if endpoint, err = s.attempt(ctx, endpoint, d); err != nil {
+				s.logFailure(err)
+			}
+			if endpoint.Disabled || ctx.Err() != nil {
+				return
+			}
+		}
+
+		if len(due) == 0 && !sleep(ctx, s.pollInterval()) {
+			return
+		}
+	}
+}
+
+// attempt makes one attempt at a delivery and records the outcome, returning
+// the endpoint as updated by it.
+func (s *Sender) attempt(ctx context.Context, endpoint Endpoint, d Delivery) (Endpoint, error) {
+	sendErr := s.post(ctx, endpoint, d)
+	if ctx.Err() != nil {
+		// Shutting down is not the endpoint's fault.
+		return endpoint, nil
+	}
+
+	now := time.Now()
+	d.Attempts++
+
+	if sendErr == nil {
+		d.Status = StatusDelivered
+		d.LastError = ""
+		if !endpoint.FailingSince.IsZero() {
+			endpoint.FailingSince = time.Time{}
+			if err := s.Store.ClearEndpointFailure(ctx, endpoint.ID); err != nil {
+				return endpoint, err
+			}
+		}
+		return endpoint, s.Store.UpdateDelivery(ctx, d)
+	}
+
+	s.logFailure(sendErr)
+	d.LastError = sendErr.Error()
+	if s.MaxAttempts != 0 && d.Attempts >= s.MaxAttempts {
+		d.Status = StatusFailed
+	} else {
+		d.NextAttempt = now.Add(backoff.Delay(s.Curve, d.Attempts-1))
+	}
+	if err := s.Store.UpdateDelivery(ctx, d); err != nil {
+		return endpoint, err
+	}
+
+	updated, err := s.Store.RecordEndpointFailure(ctx, endpoint.ID, now, s.DisableAfter)
+	if err != nil {
+		return endpoint, err
+	}
+	return updated, nil
+}
+
+func (s *Sender) post(ctx context.Context, endpoint Endpoint, d Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, d.ID)
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, time.Now(), d.Payload))
+
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	// Drain the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: endpoint %s responded %s", endpoint.ID, resp.Status)
+	}
+	return nil
+}
+
+func (s *Sender) pollInterval() time.Duration {
+	if s.PollInterval <= 0 {
+		return 5 * time.Second
+	}
+	return s.PollInterval
+}
+
+func (s *Sender) logFailure(err error) {
+	if s.LogFailure != nil {
+		s.LogFailure(err)
+	}
+}
+
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}